@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"sort"
+	"strings"
+)
+
+// PlanOptions 是传给重排算法的参数，由命令行选项设置。每种算法只使用与它相关的字段，零值是合法的设置
+type PlanOptions struct {
+	// Seed 是 shuffle 算法使用的随机种子（-seed），相同的种子和输入总是得到相同的计划
+	Seed int64
+	// ThresholdMin 和 ThresholdMax 是 threshold 算法参与排序的灰度范围（-threshmin、-threshmax，包含两端），
+	// 两者都为 0 时使用默认范围（见 thresholdRange）
+	ThresholdMin, ThresholdMax float64
+	// Descending 为 true 时像素按灰度从亮到暗排序（-sortdesc），见 grayOrder。createPlan 把它记录在计划中，
+	// wave 运动据此让亮的像素先出发
+	Descending bool
+}
+
+// checkPlanOptions 检查参数是否合法。命令在解析选项后立即调用它，createPlan 在计算计划之前也会再检查一次
+func checkPlanOptions(opts PlanOptions) error {
+	if opts.ThresholdMin > opts.ThresholdMax {
+		return fmt.Errorf("invalid threshold range: -threshmin %g is greater than -threshmax %g", opts.ThresholdMin, opts.ThresholdMax)
+	}
+	return nil
+}
+
+// PlanFunc 根据源图像和目标图像计算动画计划
+type PlanFunc func(sourceImg, targetImg image.Image, opts PlanOptions) *AnimationPlan
+
+// Algorithm 描述一种像素重排算法
+type Algorithm struct {
+	Name        string
+	Description string
+	Plan        PlanFunc
+}
+
+// largeFrameCount 是计划帧数的警告阈值，超过时提示用户限制输出的帧数
+const largeFrameCount = 500
+
+// algorithms 是所有可用重排算法的注册表，只能通过 RegisterAlgorithm 添加
+var algorithms = map[string]Algorithm{}
+
+func init() {
+	RegisterAlgorithm("default", "Sort both images by grayscale (then green, then red) and pair pixels by rank", CreateAnimationPlan)
+	RegisterAlgorithm("featured", "Like default, but break target grayscale ties by local 3x3/5x5 interval depth", CreateAnimationPlanFeatured)
+	RegisterAlgorithm("edge", "Like default, but break target grayscale ties by Sobel edge strength so edges settle last", CreateAnimationPlanEdge)
+	RegisterAlgorithm("shuffle", "Assign target positions by a seeded random permutation instead of sorting (see -seed)", CreateAnimationPlanShuffle)
+	RegisterAlgorithm("threshold", "Pixel-sort each row's runs within -threshmin..-threshmax by grayscale; the target only sets the size", CreateAnimationPlanThreshold)
+}
+
+// RegisterAlgorithm 注册一种重排算法，注册后所有命令都可以通过名称使用它，并会出现在 algorithms 列表中。
+// 名称不区分大小写，重复注册同一名称会 panic
+func RegisterAlgorithm(name, description string, fn PlanFunc) {
+	key := strings.ToLower(name)
+	if _, exists := algorithms[key]; exists {
+		panic(fmt.Sprintf("algorithm %q registered twice", name))
+	}
+	algorithms[key] = Algorithm{Name: key, Description: description, Plan: fn}
+}
+
+// algorithmNames 返回按字母顺序排列的所有算法名称
+func algorithmNames() []string {
+	names := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupAlgorithm 根据名称查找算法，名称不区分大小写
+func lookupAlgorithm(name string) (Algorithm, error) {
+	alg, ok := algorithms[strings.ToLower(name)]
+	if !ok {
+		return Algorithm{}, fmt.Errorf("unknown algorithm: %s. Please use one of: %s", name, strings.Join(algorithmNames(), ", "))
+	}
+	return alg, nil
+}
+
+// createPlan 使用指定名称的算法和参数计算动画计划
+func createPlan(name string, sourceImg, targetImg image.Image, opts PlanOptions) (*AnimationPlan, error) {
+	alg, err := lookupAlgorithm(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPlanOptions(opts); err != nil {
+		return nil, err
+	}
+	log.Printf("Creating animation plan using '%s' algorithm...", alg.Name)
+	plan := alg.Plan(sourceImg, targetImg, opts)
+	plan.Descending = opts.Descending
+	if err := checkPlanPixelCount(sourceImg, plan); err != nil {
+		return nil, fmt.Errorf("the %s algorithm produced an invalid plan: %w", alg.Name, err)
+	}
+	if plan.Frames > largeFrameCount {
+		log.Printf("Warning: this plan needs up to %d frames, so the GIF may be very large. Use -maxframes or -framestep to limit it.", plan.Frames)
+	}
+	return plan, nil
+}
+
+// printAlgorithms 打印每种算法的名称和一行说明
+func printAlgorithms() {
+	fmt.Println("Available algorithms:")
+	for _, name := range algorithmNames() {
+		fmt.Printf("  %-10s %s\n", name, algorithms[name].Description)
+	}
+}
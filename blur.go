@@ -0,0 +1,86 @@
+package main
+
+import (
+	"image"
+	"math"
+)
+
+// gaussianKernel 生成标准差为 sigma 的一维归一化高斯核，半径为 ceil(3*sigma)
+func gaussianKernel(sigma float64) []float64 {
+	radius := int(math.Ceil(sigma * 3))
+	kernel := make([]float64, 2*radius+1)
+	var sum float64
+	for i := -radius; i <= radius; i++ {
+		v := math.Exp(-float64(i*i) / (2 * sigma * sigma))
+		kernel[i+radius] = v
+		sum += v
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// GaussianBlur 对图像进行可分离的高斯模糊（先水平后垂直），边缘像素向外延伸。
+// sigma <= 0 时返回原图的副本
+func GaussianBlur(img image.Image, sigma float64) *image.RGBA {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// 以浮点数保存每个通道，避免两次卷积之间的舍入误差
+	src := make([][4]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := toRGBA(img.At(bounds.Min.X+x, bounds.Min.Y+y))
+			src[y*w+x] = [4]float64{float64(c.R), float64(c.G), float64(c.B), float64(c.A)}
+		}
+	}
+
+	if sigma > 0 {
+		kernel := gaussianKernel(sigma)
+		radius := len(kernel) / 2
+		tmp := make([][4]float64, w*h)
+
+		// 水平方向
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				var acc [4]float64
+				for k, weight := range kernel {
+					sx := min(max(x+k-radius, 0), w-1)
+					p := src[y*w+sx]
+					for c := range acc {
+						acc[c] += p[c] * weight
+					}
+				}
+				tmp[y*w+x] = acc
+			}
+		}
+
+		// 垂直方向
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				var acc [4]float64
+				for k, weight := range kernel {
+					sy := min(max(y+k-radius, 0), h-1)
+					p := tmp[sy*w+x]
+					for c := range acc {
+						acc[c] += p[c] * weight
+					}
+				}
+				src[y*w+x] = acc
+			}
+		}
+	}
+
+	dst := image.NewRGBA(bounds)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := src[y*w+x]
+			i := dst.PixOffset(bounds.Min.X+x, bounds.Min.Y+y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8(math.Round(min(max(p[c], 0), 255)))
+			}
+		}
+	}
+	return dst
+}
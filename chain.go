@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// EncodeChainedGIF 把多张图片依次串联成一个 GIF 写入 w：像素先从第一张图片重排为第二张，再从得到的结果重排为第三张，依此类推。
+// delays[i] 是第 i 段（images[i] 到 images[i+1]）每一帧的延迟，holds[i] 是这一段结束时在该关键帧上额外停留的时间，
+// 单位都是百分之一秒。两个切片的长度都必须等于段数 len(images)-1。每一段的计划都用 algorithm 和 planOpts 计算
+func EncodeChainedGIF(w io.Writer, images []image.Image, algorithm string, planOpts PlanOptions, delays, holds []int, opts GIFOptions) error {
+	if len(images) < 2 {
+		return fmt.Errorf("a chained morph needs at least 2 images, got %d", len(images))
+	}
+	segments := len(images) - 1
+	if len(delays) != segments {
+		return fmt.Errorf("got %d delays for %d segments", len(delays), segments)
+	}
+	if len(holds) != segments {
+		return fmt.Errorf("got %d holds for %d segments", len(holds), segments)
+	}
+	for i := 1; i < len(images); i++ {
+		if err := checkDimensions(images[0], images[i]); err != nil {
+			return fmt.Errorf("image %d: %w", i+1, err)
+		}
+	}
+
+	// 每一段都从上一段的结果开始，因此整个动画中始终是第一张图片的像素在移动
+	var segs []gifSegment
+	current := images[0]
+	for i := 1; i < len(images); i++ {
+		log.Printf("正在计算第 %d/%d 段的动画计划...", i, segments)
+		plan, err := createPlan(algorithm, current, images[i], planOpts)
+		if err != nil {
+			return err
+		}
+		segs = append(segs, gifSegment{Plan: plan, Delay: delays[i-1], Hold: holds[i-1]})
+		current = renderTarget(plan)
+	}
+
+	_, err := encodeSegments(w, segs, opts)
+	return err
+}
+
+// SaveChainedGIF 生成串联多张图片的 GIF 并保存到 outputPath（见 EncodeChainedGIF）
+func SaveChainedGIF(images []image.Image, algorithm, outputPath string, planOpts PlanOptions, delays, holds []int, opts GIFOptions) error {
+	log.Printf("正在生成串联的 GIF 动画并编码到 %s...", outputPath)
+	return saveToFile(outputPath, func(w io.Writer) error {
+		return EncodeChainedGIF(w, images, algorithm, planOpts, delays, holds, opts)
+	})
+}
+
+// parseIntList 解析以逗号分隔的整数列表，例如 "2,2,5"。空字符串返回 nil
+func parseIntList(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var values []int
+	for _, field := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid list %q: expected comma-separated non-negative integers", s)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
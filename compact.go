@@ -0,0 +1,121 @@
+package main
+
+import (
+	"cmp"
+	"image"
+	"image/color"
+	"iter"
+	"slices"
+	"unsafe"
+)
+
+// pixelRun 是一段起点在同一行上连续、位移相同的像素：第 i 个像素从 (StartX+i, StartY) 移动到 (StartX+i+DX, StartY+DY)
+type pixelRun struct {
+	StartX, StartY int32
+	DX, DY         int32
+	Length         int32
+}
+
+// CompactPlan 是 AnimationPlan 的低内存表示。大片平坦区域中的像素往往整体平移，
+// 起点相邻且位移相同的像素被合并为一个 pixelRun，每个像素只额外保存 4 字节的颜色，
+// 而 AnimationPixel 每个像素需要 40 字节
+type CompactPlan struct {
+	Runs []pixelRun
+	// Colors 按 Runs 的顺序依次保存每个像素的颜色
+	Colors     []color.RGBA
+	Frames     int
+	Bounds     image.Rectangle
+	BlockSize  int
+	FullTarget image.Image
+}
+
+// Compact 返回计划的紧凑表示。像素按起点的行优先顺序重新排列，
+// 只有多个像素在同一帧中落在同一格子上时，哪个像素显示在上面可能与原计划不同
+func (p *AnimationPlan) Compact() CompactPlan {
+	pixels := slices.Clone(p.Pixels)
+	slices.SortFunc(pixels, func(a, b AnimationPixel) int {
+		return cmp.Or(cmp.Compare(a.StartY, b.StartY), cmp.Compare(a.StartX, b.StartX))
+	})
+
+	cp := CompactPlan{
+		Colors:     make([]color.RGBA, 0, len(pixels)),
+		Frames:     p.Frames,
+		Bounds:     p.Bounds,
+		BlockSize:  p.BlockSize,
+		FullTarget: p.FullTarget,
+	}
+	for _, ap := range pixels {
+		dx, dy := int32(ap.TargetX-ap.StartX), int32(ap.TargetY-ap.StartY)
+		if n := len(cp.Runs); n > 0 {
+			last := &cp.Runs[n-1]
+			if last.StartY == int32(ap.StartY) && last.StartX+last.Length == int32(ap.StartX) && last.DX == dx && last.DY == dy {
+				last.Length++
+				cp.Colors = append(cp.Colors, ap.Color)
+				continue
+			}
+		}
+		cp.Runs = append(cp.Runs, pixelRun{StartX: int32(ap.StartX), StartY: int32(ap.StartY), DX: dx, DY: dy, Length: 1})
+		cp.Colors = append(cp.Colors, ap.Color)
+	}
+	return cp
+}
+
+// All 按顺序逐个展开紧凑计划中的像素，不分配整个 []AnimationPixel
+func (cp CompactPlan) All() iter.Seq[AnimationPixel] {
+	return func(yield func(AnimationPixel) bool) {
+		i := 0
+		for _, run := range cp.Runs {
+			for k := int32(0); k < run.Length; k++ {
+				x, y := int(run.StartX+k), int(run.StartY)
+				ap := AnimationPixel{
+					StartX:  x,
+					StartY:  y,
+					TargetX: x + int(run.DX),
+					TargetY: y + int(run.DY),
+					Color:   cp.Colors[i],
+				}
+				i++
+				if !yield(ap) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Expand 把紧凑计划还原为普通的 AnimationPlan
+func (cp CompactPlan) Expand() *AnimationPlan {
+	pixels := make([]AnimationPixel, 0, len(cp.Colors))
+	for ap := range cp.All() {
+		pixels = append(pixels, ap)
+	}
+	return &AnimationPlan{
+		Pixels:     pixels,
+		Frames:     cp.Frames,
+		Bounds:     cp.Bounds,
+		BlockSize:  cp.BlockSize,
+		FullTarget: cp.FullTarget,
+	}
+}
+
+// RenderTarget 直接从紧凑计划生成最终的重排图像，逐个展开像素而不还原整个计划
+func (cp CompactPlan) RenderTarget() *image.RGBA {
+	if cp.BlockSize > 1 && cp.FullTarget != nil {
+		return fullTargetRGBA(&AnimationPlan{Bounds: cp.Bounds, FullTarget: cp.FullTarget})
+	}
+	img := image.NewRGBA(cp.Bounds)
+	for ap := range cp.All() {
+		img.SetRGBA(ap.TargetX, ap.TargetY, ap.Color)
+	}
+	return img
+}
+
+// SizeBytes 返回紧凑计划中像素数据占用的字节数
+func (cp CompactPlan) SizeBytes() int {
+	return len(cp.Runs)*int(unsafe.Sizeof(pixelRun{})) + len(cp.Colors)*int(unsafe.Sizeof(color.RGBA{}))
+}
+
+// planSizeBytes 返回普通计划中像素数据占用的字节数
+func planSizeBytes(plan *AnimationPlan) int {
+	return len(plan.Pixels) * int(unsafe.Sizeof(AnimationPixel{}))
+}
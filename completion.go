@@ -0,0 +1,123 @@
+//go:build !(js && wasm)
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// commandNames 是 main 中分派的所有命令，按 printUsage 中的顺序排列
+var commandNames = []string{
+	"gif", "image", "endpoints", "montage", "fade", "text", "dissolve", "snake", "chain", "video",
+	"compare-algos", "grayhist", "sortstrip", "diffplan", "analyze", "tui", "algorithms", "selftest", "completion",
+}
+
+// flaglessCommands 是没有选项的命令，不能用 -h 查询（它们会忽略 -h 直接运行）
+var flaglessCommands = map[string]bool{"algorithms": true, "selftest": true, "completion": true, "diffplan": true}
+
+// flagLine 匹配 flag.PrintDefaults 输出中每个选项的第一行
+var flagLine = regexp.MustCompile(`^  -([\w-]+)`)
+
+// commandFlags 以 "<command> -h" 运行 exe，从 flag 包打印的帮助中取出命令的所有选项名，
+// 这样补全脚本总是与各命令实际定义的选项一致
+func commandFlags(exe, command string) ([]string, error) {
+	var out bytes.Buffer
+	cmd := exec.Command(exe, command, "-h")
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to list the options of %s: %w", command, err)
+	}
+	var flags []string
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		if m := flagLine.FindStringSubmatch(scanner.Text()); m != nil {
+			flags = append(flags, "-"+m[1])
+		}
+	}
+	return flags, scanner.Err()
+}
+
+// writeCompletion 写出指定 shell 的补全脚本，补全命令名、每个命令的选项名和算法名，其余位置补全文件名
+func writeCompletion(w io.Writer, shell string, flags map[string][]string) error {
+	algs := strings.Join(algorithmNames(), " ")
+	switch shell {
+	case "bash", "zsh":
+		if shell == "zsh" {
+			// zsh 通过 bashcompinit 复用 bash 的补全函数
+			fmt.Fprintln(w, "autoload -U +X bashcompinit && bashcompinit")
+		}
+		fmt.Fprintln(w, "_img2video() {")
+		fmt.Fprintln(w, `	local cur="${COMP_WORDS[COMP_CWORD]}" cmd="${COMP_WORDS[1]}" opts=""`)
+		fmt.Fprintln(w, "	if [ \"$COMP_CWORD\" -eq 1 ]; then")
+		fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(commandNames, " "))
+		fmt.Fprintln(w, "\t\treturn")
+		fmt.Fprintln(w, "\tfi")
+		fmt.Fprintln(w, "\tcase \"$cmd\" in")
+		for _, name := range commandNames {
+			if f := flags[name]; len(f) > 0 {
+				fmt.Fprintf(w, "\t%s) opts=%q ;;\n", name, strings.Join(f, " "))
+			}
+		}
+		fmt.Fprintln(w, "\tesac")
+		fmt.Fprintln(w, "\tcase \"$cur\" in")
+		fmt.Fprintln(w, "\t-*) COMPREPLY=($(compgen -W \"$opts\" -- \"$cur\")) ;;")
+		fmt.Fprintf(w, "\t*) COMPREPLY=($(compgen -W %q -- \"$cur\") $(compgen -f -- \"$cur\")) ;;\n", algs)
+		fmt.Fprintln(w, "\tesac")
+		fmt.Fprintln(w, "}")
+		fmt.Fprintln(w, "complete -o filenames -F _img2video img2video")
+	case "fish":
+		fmt.Fprintf(w, "complete -c img2video -n __fish_use_subcommand -f -a %q\n", strings.Join(commandNames, " "))
+		for _, name := range commandNames {
+			for _, f := range flags[name] {
+				fmt.Fprintf(w, "complete -c img2video -n '__fish_seen_subcommand_from %s' -o %s\n", name, strings.TrimPrefix(f, "-"))
+			}
+		}
+		var withAlgorithm []string
+		for _, name := range commandNames {
+			if !flaglessCommands[name] {
+				withAlgorithm = append(withAlgorithm, name)
+			}
+		}
+		fmt.Fprintf(w, "complete -c img2video -n '__fish_seen_subcommand_from %s' -a %q\n", strings.Join(withAlgorithm, " "), algs)
+	default:
+		return fmt.Errorf("unsupported shell: %s. Please use 'bash', 'zsh' or 'fish'", shell)
+	}
+	return nil
+}
+
+// handleCompletion 把 bash、zsh 或 fish 的补全脚本输出到标准输出
+func handleCompletion() {
+	if len(os.Args) < 3 {
+		printUsage()
+		exit(1)
+	}
+	shell := os.Args[2]
+	if shell != "bash" && shell != "zsh" && shell != "fish" {
+		fatalf("Error: unsupported shell: %s. Please use 'bash', 'zsh' or 'fish'.", shell)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+	flags := map[string][]string{}
+	for _, name := range commandNames {
+		if flaglessCommands[name] {
+			continue
+		}
+		if flags[name], err = commandFlags(exe, name); err != nil {
+			fatalf("Error: %v", err)
+		}
+	}
+	if err := writeCompletion(os.Stdout, shell, flags); err != nil {
+		fatalf("Error: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// configFileName 是配置文件的名称，依次在当前目录和用户主目录中查找
+const configFileName = ".img2video.yaml"
+
+// Config 存储命令行选项的默认值。
+//
+// 优先级（从低到高）：内置默认值 < 配置文件 < 环境变量 < 命令行参数。
+// 配置文件和环境变量中的值会作为命令行选项的默认值，因此命令行上显式给出的参数总是优先
+type Config struct {
+	Algorithm string // 键 algorithm
+	Delay     int    // 键 delay，单位为百分之一秒
+	Palette   string // 键 palette
+	FrameStep int    // 键 framestep
+	MaxPixels int    // 键 maxpixels
+	Motion    string // 键 motion
+}
+
+// defaultConfig 返回内置的默认配置
+func defaultConfig() Config {
+	return Config{
+		Algorithm: "default",
+		Delay:     1,
+		Palette:   "plan9",
+		FrameStep: 1,
+		MaxPixels: defaultMaxPixels,
+		Motion:    "random",
+	}
+}
+
+// envPrefix 是环境变量名的前缀，例如键 algorithm 对应 IMG2VIDEO_ALGORITHM
+const envPrefix = "IMG2VIDEO_"
+
+// configKeys 是所有配置项的键名，与 Config.set 支持的键一致
+var configKeys = []string{"algorithm", "delay", "palette", "framestep", "maxpixels", "motion"}
+
+// configSearchPath 返回按优先顺序排列的配置文件候选路径
+func configSearchPath() []string {
+	paths := []string{configFileName}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, configFileName))
+	}
+	return paths
+}
+
+// loadConfig 在默认配置的基础上合并找到的第一个配置文件，再合并 IMG2VIDEO_* 环境变量，
+// 返回配置和所用文件的路径（未找到时为空）
+func loadConfig() (Config, string, error) {
+	cfg := defaultConfig()
+	cfgPath := ""
+	for _, path := range configSearchPath() {
+		file, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return cfg, "", fmt.Errorf("failed to open config file %s: %w", path, err)
+		}
+		defer file.Close()
+		if err := parseConfig(file, &cfg); err != nil {
+			return cfg, "", fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+		cfgPath = path
+		break
+	}
+	if err := applyEnv(&cfg, os.LookupEnv); err != nil {
+		return cfg, cfgPath, err
+	}
+	return cfg, cfgPath, nil
+}
+
+// applyEnv 用 lookup 查找每个配置项对应的环境变量（如 IMG2VIDEO_DELAY），设置了的覆盖 cfg 中的值
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	for _, key := range configKeys {
+		name := envPrefix + strings.ToUpper(key)
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := cfg.set(key, strings.TrimSpace(value)); err != nil {
+			return fmt.Errorf("environment variable %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// parseConfig 解析 YAML 的一个简单子集：每行一个 "key: value"，支持 # 注释和带引号的字符串值
+func parseConfig(r io.Reader, cfg *Config) error {
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("line %d: expected \"key: value\"", lineNo)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+
+		if err := cfg.set(key, value); err != nil {
+			return fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// set 根据键名设置一个配置项
+func (cfg *Config) set(key, value string) error {
+	var err error
+	switch key {
+	case "algorithm":
+		cfg.Algorithm = value
+	case "delay":
+		cfg.Delay, err = strconv.Atoi(value)
+	case "palette":
+		cfg.Palette = value
+	case "framestep":
+		cfg.FrameStep, err = strconv.Atoi(value)
+	case "maxpixels":
+		cfg.MaxPixels, err = strconv.Atoi(value)
+	case "motion":
+		cfg.Motion = value
+	default:
+		return fmt.Errorf("unknown key %q", key)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %q", key, value)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"log"
+	"math"
+)
+
+// grayscaleImage 把 imageToPixels 计算出的 GrayscaleValue 映射回 8 位灰度图，
+// 用于直观地检查排序所依据的灰度值
+func grayscaleImage(img image.Image) *image.Gray {
+	gray := image.NewGray(img.Bounds())
+	for p := range imagePixels(img) {
+		gray.Pix[gray.PixOffset(p.OriginalX, p.OriginalY)] = uint8(math.Round(min(max(p.GrayscaleValue, 0), 255)))
+	}
+	return gray
+}
+
+// SaveGrayscaleDebug 把源图和目标图的灰度值并排（左源右目标）保存为 PNG
+func SaveGrayscaleDebug(sourceImg, targetImg image.Image, outputPath string) error {
+	sourceGray := grayscaleImage(sourceImg)
+	targetGray := grayscaleImage(targetImg)
+
+	sw, th := sourceGray.Bounds().Dx(), targetGray.Bounds().Dy()
+	canvas := image.NewGray(image.Rect(0, 0, sw+targetGray.Bounds().Dx(), max(sourceGray.Bounds().Dy(), th)))
+	draw.Draw(canvas, image.Rect(0, 0, sw, sourceGray.Bounds().Dy()), sourceGray, sourceGray.Bounds().Min, draw.Src)
+	draw.Draw(canvas, image.Rect(sw, 0, canvas.Bounds().Dx(), th), targetGray, targetGray.Bounds().Min, draw.Src)
+
+	log.Printf("正在将灰度调试图保存到 %s...", outputPath)
+	return savePNG(canvas, outputPath)
+}
+
+// SortStrip 把图像的像素按算法对目标图像的排序依次排开：第 i 个像素是计划中第 i 个目标位置上的像素，
+// 从左到右、每 width 个像素换一行（width 为 0 时排成一行）。以图像自身作为源图和目标图计算计划，
+// 因此 default 算法得到 sort.Sort(Pixels(...)) 产生的灰度渐变，featured 和 edge 算法则显示区间深度和边缘强度
+// 如何打乱同一灰度内的顺序
+func SortStrip(img image.Image, algorithm string, width int) (*image.RGBA, error) {
+	if width < 0 {
+		return nil, fmt.Errorf("invalid strip width %d: must be at least 0", width)
+	}
+	plan, err := createPlan(algorithm, img, img, PlanOptions{})
+	if err != nil {
+		return nil, err
+	}
+	n := len(plan.Pixels)
+	if width == 0 || width > n {
+		width = max(1, n)
+	}
+	strip := image.NewRGBA(image.Rect(0, 0, width, (n+width-1)/width))
+	for i, ap := range plan.Pixels {
+		strip.SetRGBA(i%width, i/width, toRGBA(img.At(ap.TargetX, ap.TargetY)))
+	}
+	return strip, nil
+}
+
+// SaveSortStrip 把 SortStrip 生成的像素序列保存为 PNG
+func SaveSortStrip(img image.Image, algorithm string, width int, outputPath string) error {
+	strip, err := SortStrip(img, algorithm, width)
+	if err != nil {
+		return err
+	}
+	log.Printf("正在将 %dx%d 的排序像素条保存到 %s...", strip.Bounds().Dx(), strip.Bounds().Dy(), outputPath)
+	return savePNG(strip, outputPath)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/jpeg" // 导入 JPEG 解码器以支持解码
+	_ "image/png"  // 导入 PNG 解码器以支持解码
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// defaultMaxPixels 是输入图片允许的默认最大像素数，防止超大图片耗尽内存
+const defaultMaxPixels = 4096 * 4096
+
+// decodeImage 从 r 中解码图片，像素数超过 maxPixels 时返回包装了 ErrImageTooLarge 的错误（maxPixels <= 0 表示不限制），
+// 无法识别图片格式时返回包装了 ErrUnsupportedFormat 的错误。name 只用于错误信息
+func decodeImage(r io.ReadSeeker, name string, maxPixels int) (image.Image, error) {
+	// 先只解码图片头部获取尺寸，避免为超大图片分配内存
+	cfg, _, err := image.DecodeConfig(r)
+	if errors.Is(err, image.ErrFormat) {
+		return nil, fmt.Errorf("failed to decode image file %s: %w", name, ErrUnsupportedFormat)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image file %s: %w", name, err)
+	}
+	if maxPixels > 0 && cfg.Width*cfg.Height > maxPixels {
+		return nil, fmt.Errorf("image file %s: %w: %dx%d exceeds the limit of %d pixels (use -maxpixels to raise it)", name, ErrImageTooLarge, cfg.Width, cfg.Height, maxPixels)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind image file %s: %w", name, err)
+	}
+
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image file %s: %w", name, err)
+	}
+	return normalizeImage(img), nil
+}
+
+// normalizeImage 把解码得到的图像统一转换为 image.RGBA，使 JPEG 的 YCbCr、CMYK 以及灰度、16 位等
+// 各种颜色模型在后续的像素和灰度计算中都经过同一条颜色转换路径。
+// 调色板图像保持原样：-palette source 需要读取它的调色板，而它的 At 本来就直接返回调色板中的颜色
+func normalizeImage(img image.Image) image.Image {
+	switch img.(type) {
+	case *image.RGBA, *image.Paletted:
+		return img
+	}
+	return toRGBAImage(img)
+}
+
+// toRGBAImage 把任意图像复制为坐标范围相同的 RGBA 图像
+func toRGBAImage(img image.Image) *image.RGBA {
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return rgba
+}
+
+// decodeImageBytes 从内存中的字节解码图片
+func decodeImageBytes(data []byte, name string, maxPixels int) (image.Image, error) {
+	return decodeImage(bytes.NewReader(data), name, maxPixels)
+}
+
+// splitZipPath 把 bundle.zip#source.png 形式的路径拆分为压缩包路径和其中的文件名
+func splitZipPath(p string) (archive, entry string, ok bool) {
+	i := strings.Index(strings.ToLower(p), ".zip#")
+	if i < 0 {
+		return "", "", false
+	}
+	return p[:i+len(".zip")], p[i+len(".zip#"):], true
+}
+
+// readZipImage 从 zip 压缩包中读取名为 entry 的图片
+func readZipImage(archive, entry string, maxPixels int) (image.Image, error) {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip archive %s: %w", archive, err)
+	}
+	defer r.Close()
+
+	f, err := r.Open(entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s in zip archive %s: %w", entry, archive, err)
+	}
+	defer f.Close()
+	// 解码需要能够回退到开头，因此先把文件读入内存；像素数仍由 decodeImage 检查
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s in zip archive %s: %w", entry, archive, err)
+	}
+	return decodeImageBytes(data, archive+"#"+entry, maxPixels)
+}
+
+// readImage 从指定路径读取图片，像素数超过 maxPixels 时返回错误（maxPixels <= 0 表示不限制）。
+// 路径形如 bundle.zip#source.png 且不是一个已存在的文件时，从 zip 压缩包中读取对应的文件
+func readImage(filePath string, maxPixels int) (image.Image, error) {
+	if archive, entry, ok := splitZipPath(filePath); ok {
+		if _, err := os.Stat(filePath); errors.Is(err, fs.ErrNotExist) {
+			return readZipImage(archive, entry, maxPixels)
+		}
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	return decodeImage(file, filePath, maxPixels)
+}
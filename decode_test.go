@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// cmykJPEG 手工构造一张 8x8 纯色的 Adobe CMYK JPEG（标准库只能编码 YCbCr 和灰度 JPEG）。
+// 每个分量只有一个 8x8 块，量化表全为 1，块中只有直流系数，交流系数直接以 EOB 结束。
+// Adobe CMYK JPEG 中存储的是反相的值（255 表示没有油墨）
+func cmykJPEG(c color.CMYK) []byte {
+	var b bytes.Buffer
+	segment := func(marker byte, payload ...byte) {
+		b.Write([]byte{0xFF, marker, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)})
+		b.Write(payload)
+	}
+	b.Write([]byte{0xFF, 0xD8}) // SOI
+	// APP14 Adobe，transform 为 0 表示 CMYK
+	segment(0xEE, 'A', 'd', 'o', 'b', 'e', 0, 100, 0, 0, 0, 0, 0)
+	segment(0xDB, append([]byte{0}, bytes.Repeat([]byte{1}, 64)...)...)
+	segment(0xC0, 8, 0, 8, 0, 8, 4, 1, 0x11, 0, 2, 0x11, 0, 3, 0x11, 0, 4, 0x11, 0)
+	// 直流表：类别 0-11 都使用 4 位码，码值等于类别；交流表只有一个 1 位的 EOB
+	segment(0xC4, append(append([]byte{0x00, 0, 0, 0, 12}, make([]byte, 12)...), 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11)...)
+	segment(0xC4, append([]byte{0x10, 1}, make([]byte, 16)...)...)
+	segment(0xDA, 4, 1, 0, 2, 0, 3, 0, 4, 0, 0, 63, 0)
+
+	var bits uint32
+	var n uint
+	var scan []byte
+	put := func(v uint32, size uint) {
+		bits, n = bits<<size|v&(1<<size-1), n+size
+		for n >= 8 {
+			by := byte(bits >> (n - 8))
+			scan = append(scan, by)
+			if by == 0xFF {
+				scan = append(scan, 0) // 字节填充
+			}
+			n -= 8
+		}
+	}
+	for _, ink := range []uint8{c.C, c.M, c.Y, c.K} {
+		dc := 8 * (int(255-ink) - 128)
+		size, v := uint(0), dc
+		for a := max(dc, -dc); a > 0; a >>= 1 {
+			size++
+		}
+		if dc < 0 {
+			v = dc + 1<<size - 1
+		}
+		put(uint32(size), 4)
+		put(uint32(v), size)
+		put(0, 1) // EOB
+	}
+	put(0x7F, 7) // 用 1 补齐最后一个字节
+	b.Write(scan)
+	b.Write([]byte{0xFF, 0xD9}) // EOI
+	return b.Bytes()
+}
+
+// TestDecodeCMYKJPEG 解码几张纯色的 CMYK JPEG，检查读入的图像已被统一为 RGBA，并且颜色与 CMYK 换算的结果相近
+func TestDecodeCMYKJPEG(t *testing.T) {
+	for _, c := range []color.CMYK{
+		{C: 0x10, M: 0x80, Y: 0xF0, K: 0x40},
+		{C: 0, M: 0, Y: 0, K: 0},
+		{C: 0xFF, M: 0x20, Y: 0x00, K: 0x00},
+	} {
+		img, err := decodeImageBytes(cmykJPEG(c), "cmyk.jpg", 0)
+		if err != nil {
+			t.Fatalf("%v: %v", c, err)
+		}
+		rgba, ok := img.(*image.RGBA)
+		if !ok {
+			t.Fatalf("%v: decoded image is %T, want *image.RGBA", c, img)
+		}
+		want := toRGBA(c)
+		got := rgba.RGBAAt(4, 4)
+		for i, pair := range [][2]uint8{{got.R, want.R}, {got.G, want.G}, {got.B, want.B}, {got.A, want.A}} {
+			if d := int(pair[0]) - int(pair[1]); d < -2 || d > 2 {
+				t.Errorf("%v: channel %d of the decoded color %v is too far from %v", c, i, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"log"
+)
+
+// dissolveFrame 返回 source 和 target 按比例 t（0 为 source，1 为 target）逐像素混合的图像。
+// 两张图像都是预乘 alpha 的 RGBA，直接对每个通道线性插值即可得到正确的混合结果
+func dissolveFrame(source, target *image.RGBA, t float64) *image.RGBA {
+	frame := image.NewRGBA(source.Rect)
+	for i := range frame.Pix {
+		s, d := float64(source.Pix[i]), float64(target.Pix[i])
+		frame.Pix[i] = uint8(s + (d-s)*t + 0.5)
+	}
+	return frame
+}
+
+// EncodeDissolve 生成从 source 到 target 的淡入淡出（交叉溶解）GIF 并写入 w：像素不移动，
+// 每个位置的颜色在 frames 帧内从源图像的颜色线性过渡到目标图像同一位置的颜色。
+// 与其他命令不同，它不对像素排序或分配位置，因此两张图像的颜色都会出现在动画中
+func EncodeDissolve(w io.Writer, sourceImg, targetImg image.Image, frames, delay int, opts GIFOptions) (GIFResult, error) {
+	if err := checkDimensions(sourceImg, targetImg); err != nil {
+		return GIFResult{}, err
+	}
+	if frames < 2 {
+		return GIFResult{}, fmt.Errorf("a dissolve needs at least 2 frames, got %d", frames)
+	}
+	source, target := toRGBAImage(sourceImg), toRGBAImage(targetImg)
+	// 源图像和目标图像的坐标原点可能不同，统一到源图像的坐标
+	target.Rect = source.Rect
+
+	samples := func() []*image.RGBA {
+		return []*image.RGBA{source, dissolveFrame(source, target, 0.5), target}
+	}
+	return encodeFrames(w, samples, opts, func(sink *frameSink) error {
+		for i := 0; i < frames; i++ {
+			sink.Add(dissolveFrame(source, target, float64(i)/float64(frames-1)), delay)
+		}
+		return nil
+	})
+}
+
+// SaveDissolve 生成淡入淡出 GIF 并保存到 outputPath（见 EncodeDissolve）
+func SaveDissolve(sourceImg, targetImg image.Image, frames int, outputPath string, delay int, opts GIFOptions) (GIFResult, error) {
+	log.Printf("正在生成淡入淡出动画并编码到 %s...", outputPath)
+	var result GIFResult
+	err := saveToFile(outputPath, func(w io.Writer) (err error) {
+		result, err = EncodeDissolve(w, sourceImg, targetImg, frames, delay, opts)
+		return err
+	})
+	return result, err
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DistanceFunc 计算点 (ax, ay) 到点 (bx, by) 的距离。现有的算法都按灰度排名（或随机）分配目标位置，
+// 不以移动距离作为代价，因此距离函数只用于 analyze 报告像素的移动距离（TotalDistance、MaxDistance），不影响计划
+type DistanceFunc func(ax, ay, bx, by int) float64
+
+// Manhattan 是 L1 距离：|dx| + |dy|
+func Manhattan(ax, ay, bx, by int) float64 {
+	return float64(abs(bx-ax) + abs(by-ay))
+}
+
+// Euclidean 是 L2 距离：sqrt(dx² + dy²)
+func Euclidean(ax, ay, bx, by int) float64 {
+	return math.Hypot(float64(bx-ax), float64(by-ay))
+}
+
+// Chebyshev 是 L∞ 距离：max(|dx|, |dy|)，等于逐步移动时像素到达目标所需的步数
+func Chebyshev(ax, ay, bx, by int) float64 {
+	return float64(max(abs(bx-ax), abs(by-ay)))
+}
+
+// distanceByName 根据名称返回距离函数，空名称表示默认的 Euclidean
+func distanceByName(name string) (DistanceFunc, error) {
+	switch strings.ToLower(name) {
+	case "", "euclidean", "l2":
+		return Euclidean, nil
+	case "manhattan", "l1":
+		return Manhattan, nil
+	case "chebyshev", "linf":
+		return Chebyshev, nil
+	default:
+		return nil, fmt.Errorf("unknown distance metric: %s. Please use 'euclidean', 'manhattan' or 'chebyshev'", name)
+	}
+}
+
+// TotalDistance 返回计划中所有像素从起点到终点的距离之和
+func TotalDistance(plan *AnimationPlan, dist DistanceFunc) float64 {
+	var total float64
+	for _, ap := range plan.Pixels {
+		total += dist(ap.StartX, ap.StartY, ap.TargetX, ap.TargetY)
+	}
+	return total
+}
+
+// MaxDistance 返回计划中移动最远的像素从起点到终点的距离
+func MaxDistance(plan *AnimationPlan, dist DistanceFunc) float64 {
+	var longest float64
+	for _, ap := range plan.Pixels {
+		longest = max(longest, dist(ap.StartX, ap.StartY, ap.TargetX, ap.TargetY))
+	}
+	return longest
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+// TestDistance 在已知的点对上检查每种距离度量，距离函数通过 distanceByName 按名称和别名取得
+func TestDistance(t *testing.T) {
+	points := [][4]int{{0, 0, 3, 4}, {5, 5, 5, 5}, {2, -1, -4, 7}}
+	for _, tc := range []struct {
+		names []string
+		want  []float64 // 对应 points 中的每一对点
+	}{
+		{[]string{"", "euclidean", "l2"}, []float64{5, 0, 10}},
+		{[]string{"manhattan", "L1"}, []float64{7, 0, 14}},
+		{[]string{"chebyshev", "linf"}, []float64{4, 0, 8}},
+	} {
+		for _, name := range tc.names {
+			dist, err := distanceByName(name)
+			if err != nil {
+				t.Fatalf("%q: %v", name, err)
+			}
+			for i, p := range points {
+				if got := dist(p[0], p[1], p[2], p[3]); got != tc.want[i] {
+					t.Errorf("%q: (%d,%d)-(%d,%d) = %v, want %v", name, p[0], p[1], p[2], p[3], got, tc.want[i])
+				}
+			}
+		}
+	}
+	if _, err := distanceByName("taxicab"); err == nil {
+		t.Error("an unknown metric was accepted")
+	}
+}
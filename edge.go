@@ -0,0 +1,80 @@
+package main
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// PixelEdge 结构体用于边缘排序，增加了边缘强度字段
+type PixelEdge struct {
+	Pixel
+	EdgeStrength float64
+}
+
+// PixelsByEdge 是 PixelEdge 的切片，先按灰度值排序，灰度相同时按边缘强度排序，
+// 使得同一灰度中位于平坦区域的像素先被分配、位于强边缘上的像素后被分配
+type PixelsByEdge []PixelEdge
+
+func (p PixelsByEdge) Len() int      { return len(p) }
+func (p PixelsByEdge) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p PixelsByEdge) Less(i, j int) bool {
+	if p[i].GrayscaleValue != p[j].GrayscaleValue {
+		return p[i].GrayscaleValue < p[j].GrayscaleValue
+	}
+	return p[i].EdgeStrength < p[j].EdgeStrength
+}
+
+// sobelMagnitude 使用 Sobel 算子计算灰度网格中每个点的梯度幅值，越界的邻居取最近的边缘值。
+// 返回的网格与输入的网格坐标一致
+func sobelMagnitude(grayGrid [][]float64) [][]float64 {
+	h := len(grayGrid)
+	magnitude := make([][]float64, h)
+	at := func(x, y int) float64 {
+		y = min(max(y, 0), h-1)
+		row := grayGrid[y]
+		if len(row) == 0 {
+			return 0
+		}
+		return row[min(max(x, 0), len(row)-1)]
+	}
+	for y := 0; y < h; y++ {
+		magnitude[y] = make([]float64, len(grayGrid[y]))
+		for x := range grayGrid[y] {
+			gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) -
+				at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) -
+				at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+			magnitude[y][x] = math.Hypot(gx, gy)
+		}
+	}
+	return magnitude
+}
+
+// CreateAnimationPlanEdge 使用边缘排序计算动画计划：源图使用默认复杂排序，
+// 目标图在灰度相同时按 Sobel 梯度幅值排序
+func CreateAnimationPlanEdge(sourceImg, targetImg image.Image, opts PlanOptions) *AnimationPlan {
+	sourcePixels := imageToPixels(sourceImg)
+	targetPixelsRaw := imageToPixels(targetImg)
+
+	// 1. 对源图使用默认复杂排序
+	sort.Sort(grayOrder(Pixels(sourcePixels), opts.Descending))
+
+	// 2. 计算目标图每个像素的边缘强度并排序
+	bounds := targetImg.Bounds()
+	edges := sobelMagnitude(buildGrayGrid(targetImg))
+	targetPixelsEdge := make([]PixelEdge, len(targetPixelsRaw))
+	for i, p := range targetPixelsRaw {
+		// 灰度网格的坐标相对于 bounds.Min
+		edge := edges[p.OriginalY-bounds.Min.Y][p.OriginalX-bounds.Min.X]
+		targetPixelsEdge[i] = PixelEdge{Pixel: p, EdgeStrength: edge}
+	}
+	sort.Sort(grayOrder(PixelsByEdge(targetPixelsEdge), opts.Descending))
+
+	// 将 targetPixelsEdge 转换为 PixelFeatured 以匹配 calculatePlan 的签名
+	targetPixelsFeatured := make([]PixelFeatured, len(targetPixelsEdge))
+	for i, p := range targetPixelsEdge {
+		targetPixelsFeatured[i] = PixelFeatured{Pixel: p.Pixel}
+	}
+	return calculatePlan(sourcePixels, targetPixelsFeatured, sourceImg.Bounds())
+}
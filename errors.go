@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// 以下错误会被包装后返回，调用方可以用 errors.Is 区分失败的原因
+var (
+	// ErrDimensionMismatch 表示两张需要对应的图像（源图像、目标图像或遮罩）尺寸不同
+	ErrDimensionMismatch = errors.New("image dimensions must be the same")
+	// ErrUnsupportedFormat 表示输入的数据不是可以解码的图片格式
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	// ErrUnsupportedExtension 表示无法根据输出文件的扩展名确定编码格式
+	ErrUnsupportedExtension = errors.New("unsupported output file extension")
+	// ErrImageTooLarge 表示输入图片的像素数超过了限制
+	ErrImageTooLarge = errors.New("image is too large")
+)
+
+// checkDimensions 检查源图像和目标图像的尺寸是否相同，不同时返回包装了 ErrDimensionMismatch 的错误
+func checkDimensions(sourceImg, targetImg image.Image) error {
+	sb, tb := sourceImg.Bounds(), targetImg.Bounds()
+	if sb != tb {
+		return fmt.Errorf("%w: source is %dx%d, target is %dx%d", ErrDimensionMismatch, sb.Dx(), sb.Dy(), tb.Dx(), tb.Dy())
+	}
+	return nil
+}
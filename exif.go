@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// exifHeader 是 APP1 段中 EXIF 数据的标识
+var exifHeader = []byte("Exif\x00\x00")
+
+// readJPEGExif 从 JPEG 文件中读取完整的 EXIF APP1 段（包括 0xFFE1 标记和长度），
+// 文件中没有 EXIF 时返回 nil
+func readJPEGExif(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, fmt.Errorf("%s is not a JPEG file", path)
+	}
+
+	// 依次遍历 SOI 之后的各个段，直到图像数据开始 (SOS)
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return nil, errors.New("malformed JPEG marker in " + path)
+		}
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 { // SOS 或 EOI
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, errors.New("truncated JPEG segment in " + path)
+		}
+		if marker == 0xE1 && bytes.HasPrefix(data[pos+4:end], exifHeader) {
+			return data[pos:end], nil
+		}
+		pos = end
+	}
+	return nil, nil
+}
+
+// insertJPEGSegment 把一个完整的段插入到 JPEG 数据的 SOI 标记之后
+func insertJPEGSegment(jpegData, segment []byte) []byte {
+	out := make([]byte, 0, len(jpegData)+len(segment))
+	out = append(out, jpegData[:2]...)
+	out = append(out, segment...)
+	return append(out, jpegData[2:]...)
+}
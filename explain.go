@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"time"
+)
+
+// renderSummary 是 -explain 在渲染前报告的内容
+type renderSummary struct {
+	Algorithm string
+	// Pixels 是计划中的像素数，Moving 是其中起点与终点不同的像素数
+	Pixels, Moving int
+	// Frames 是 GIF 中的帧数，TotalDelay 是播放一遍的时长（百分之一秒），都已计入返回段、LoopDelay 和合并的帧
+	Frames     int
+	TotalDelay int
+	// Width 和 Height 是输出帧的尺寸（已应用 -outsize）
+	Width, Height int
+	FrameStep     int
+	// Speed 是 -cap-strategy speed 选择的运动速度倍数
+	Speed int
+	// Delay 是每帧的延迟，单位为 1/100 秒
+	Delay   int
+	Palette string
+	// Colors 是重排结果中不同颜色的数量，见 UniqueColors
+	Colors     int
+	Motion     string
+	Seed       int64
+	MotionSeed int64
+}
+
+// summarizeRender 模拟一次渲染，按 encodeFrames 的规则得到 GIF 的帧数和时长，汇总 -explain 需要报告的信息：
+// 倒序返回段（Boomerang）、最后一帧的 LoopDelay，以及 Trim 合并的相同连续帧。Trim 按缩放后的 RGBA 帧比较，
+// 只在量化后才变得相同的帧不会被计入合并，因此这时报告的帧数可能略多于实际的帧数。
+// 随机运动的种子为 0 时帧数每次不同，调用方应先固定 opts.Seed
+func summarizeRender(plan *AnimationPlan, opts GIFOptions, delay int) (renderSummary, error) {
+	// ids[i] 是第 i 帧内容的编号，与前一帧完全相同的帧沿用前一帧的编号
+	var ids []int
+	var emit func(frame *image.RGBA)
+	if opts.Trim {
+		var prev *image.RGBA
+		emit = func(frame *image.RGBA) {
+			frame = opts.OutSize.Apply(frame)
+			if prev != nil && prev.Rect == frame.Rect && bytes.Equal(prev.Pix, frame.Pix) {
+				ids = append(ids, ids[len(ids)-1])
+			} else {
+				ids = append(ids, len(ids))
+			}
+			prev = frame
+		}
+	}
+	frames, err := RenderFrames(plan, opts.FrameOptions, emit)
+	if err != nil {
+		return renderSummary{}, err
+	}
+	if !opts.Trim {
+		for i := 0; i < frames; i++ {
+			ids = append(ids, i)
+		}
+	}
+	delays := make([]int, len(ids))
+	for i := range delays {
+		delays[i] = delay
+	}
+	if opts.Boomerang {
+		for i := frames - 2; i >= 1; i-- {
+			id := ids[i]
+			if opts.InvertReturn {
+				// 反转颜色的帧与正向的帧不同
+				id += frames
+			}
+			ids = append(ids, id)
+			delays = append(delays, delays[i])
+		}
+	}
+	if opts.LoopDelay > 0 && len(delays) > 0 {
+		delays[len(delays)-1] = opts.LoopDelay
+	}
+	gifFrames, totalDelay := 0, 0
+	for i, d := range delays {
+		if !opts.Trim || i == 0 || ids[i] != ids[i-1] {
+			gifFrames++
+		}
+		totalDelay += d
+	}
+
+	moving := 0
+	for _, ap := range plan.Pixels {
+		if ap.StartX != ap.TargetX || ap.StartY != ap.TargetY {
+			moving++
+		}
+	}
+	// 分块计划的 Bounds 是块的网格，输出的帧是全分辨率的
+	bounds := plan.Bounds
+	if plan.BlockSize > 1 && plan.FullTarget != nil {
+		bounds = plan.FullTarget.Bounds()
+	}
+	w, h := bounds.Dx(), bounds.Dy()
+	if opts.OutSize.Width > 0 && opts.OutSize.Height > 0 {
+		w, h = opts.OutSize.size(w, h)
+	}
+	return renderSummary{
+		Pixels:     len(plan.Pixels),
+		Moving:     moving,
+		Frames:     gifFrames,
+		TotalDelay: totalDelay,
+		Width:      w,
+		Height:     h,
+		FrameStep:  max(opts.FrameStep, 1),
+		Speed:      max(opts.Speed, 1),
+		Delay:      delay,
+		Colors:     UniqueColors(renderTarget(plan)),
+		Motion:     opts.Motion,
+		MotionSeed: opts.Seed,
+	}, nil
+}
+
+// writeSummary 把渲染摘要以便于阅读的形式写入 w。估计的大小是未压缩的帧数据（每像素 1 字节的调色板索引），
+// 实际的 GIF 经过 LZW 压缩和逐帧差分后通常小得多
+func writeSummary(w io.Writer, s renderSummary) {
+	fmt.Fprintln(w, "Render plan:")
+	fmt.Fprintf(w, "  algorithm:   %s\n", s.Algorithm)
+	fmt.Fprintf(w, "  pixels:      %d (%d moving)\n", s.Pixels, s.Moving)
+	fmt.Fprintf(w, "  frame size:  %dx%d\n", s.Width, s.Height)
+	speed := ""
+	if s.Speed > 1 {
+		speed = fmt.Sprintf(", speed %dx", s.Speed)
+	}
+	fmt.Fprintf(w, "  frames:      %d (framestep %d%s, delay %d/100 s, about %s)\n",
+		s.Frames, s.FrameStep, speed, s.Delay, time.Duration(s.TotalDelay)*10*time.Millisecond)
+	fmt.Fprintf(w, "  palette:     %s\n", s.Palette)
+	if s.Colors <= 256 {
+		fmt.Fprintf(w, "  colors:      %d unique (a %d-color palette would be exact)\n", s.Colors, s.Colors)
+	} else {
+		fmt.Fprintf(w, "  colors:      %d unique (more than 256, quantization is unavoidable)\n", s.Colors)
+	}
+	fmt.Fprintf(w, "  motion:      %s\n", s.Motion)
+	fmt.Fprintf(w, "  seed:        %d (motion seed %d)\n", s.Seed, s.MotionSeed)
+	raw := int64(s.Frames) * int64(s.Width) * int64(s.Height)
+	fmt.Fprintf(w, "  estimated:   at most %d KB of uncompressed frame data\n", (raw+1023)/1024)
+}
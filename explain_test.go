@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+// TestSummarizeRenderMatchesEncode 检查 -explain 报告的帧数、时长和尺寸与 EncodeGIF 实际生成的一致
+func TestSummarizeRenderMatchesEncode(t *testing.T) {
+	pair := fixturePairs()[3]
+	plan := CreateAnimationPlan(pair.Source, pair.Target, PlanOptions{})
+	// 源图像和目标图像相同时每一帧都一样，-trim 会把它们合并成一帧
+	still := CreateAnimationPlan(pair.Target, pair.Target, PlanOptions{})
+	block, err := createBlockPlan("default", pair.Source, pair.Target, 4, PlanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		plan *AnimationPlan
+		opts GIFOptions
+	}{
+		{"plain", plan, GIFOptions{}},
+		{"boomerang", plan, GIFOptions{Boomerang: true}},
+		{"boomerang/invert", plan, GIFOptions{Boomerang: true, InvertReturn: true}},
+		{"loopdelay", plan, GIFOptions{LoopDelay: 150}},
+		{"boomerang/loopdelay", plan, GIFOptions{Boomerang: true, LoopDelay: 150}},
+		{"trim", plan, GIFOptions{Trim: true}},
+		{"trim/still", still, GIFOptions{Trim: true}},
+		{"trim/boomerang", still, GIFOptions{Trim: true, Boomerang: true, LoopDelay: 80}},
+		{"blocksize", block, GIFOptions{}},
+		{"outsize", block, GIFOptions{OutSize: OutputSize{Width: 12, Height: 8}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.Motion = "deterministic"
+			summary, err := summarizeRender(tc.plan, tc.opts, 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := EncodeGIF(io.Discard, tc.plan, 5, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := fmt.Sprintf("%d frames, %d delay, %dx%d", summary.Frames, summary.TotalDelay, summary.Width, summary.Height)
+			want := fmt.Sprintf("%d frames, %d delay, %dx%d", result.Frames, result.TotalDelay, result.Width, result.Height)
+			if got != want {
+				t.Errorf("summary = %s, EncodeGIF = %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+)
+
+// parseHexColor 解析 #rgb、#rrggbb 或 #rrggbbaa 形式的颜色，开头的 # 可以省略
+func parseHexColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	switch len(hex) {
+	case 3:
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]}) + "ff"
+	case 6:
+		hex += "ff"
+	case 8:
+	default:
+		return color.RGBA{}, fmt.Errorf("invalid color %q: use #rgb, #rrggbb or #rrggbbaa", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q: %w", s, err)
+	}
+	return toRGBA(color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}), nil
+}
+
+// solidImage 创建一张给定尺寸、所有像素都是颜色 c 的图像，作为 fade 命令的目标图像
+func solidImage(bounds image.Rectangle, c color.Color) *image.RGBA {
+	img := image.NewRGBA(bounds)
+	draw.Draw(img, bounds, image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
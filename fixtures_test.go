@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// fixtureBounds 是测试夹具图片的尺寸，保持很小以便所有算法都能快速运行
+var fixtureBounds = image.Rect(0, 0, 24, 16)
+
+// fixturePair 是一对用于测试的合成图片
+type fixturePair struct {
+	Name           string
+	Source, Target image.Image
+}
+
+// fixtureImage 用 f 返回的颜色生成一张 fixtureBounds 大小的图片
+func fixtureImage(f func(x, y int) color.RGBA) *image.RGBA {
+	img := image.NewRGBA(fixtureBounds)
+	for y := fixtureBounds.Min.Y; y < fixtureBounds.Max.Y; y++ {
+		for x := fixtureBounds.Min.X; x < fixtureBounds.Max.X; x++ {
+			img.SetRGBA(x, y, f(x, y))
+		}
+	}
+	return img
+}
+
+// noiseImage 生成固定种子的随机噪点图片
+func noiseImage(seed int64) *image.RGBA {
+	rng := rand.New(rand.NewSource(seed))
+	return fixtureImage(func(x, y int) color.RGBA {
+		return color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 0xFF}
+	})
+}
+
+// sceneImage 生成一张类似照片的图片：渐变的天空、两个柔和的光斑和少量固定种子的噪点
+func sceneImage(seed int64) *image.RGBA {
+	rng := rand.New(rand.NewSource(seed))
+	cx, cy := float64(rng.Intn(fixtureBounds.Dx())), float64(rng.Intn(fixtureBounds.Dy()))
+	return fixtureImage(func(x, y int) color.RGBA {
+		glow := 0.0
+		for _, c := range [][2]float64{{cx, cy}, {float64(fixtureBounds.Dx()) - cx, float64(fixtureBounds.Dy()) / 2}} {
+			d := math.Hypot(float64(x)-c[0], float64(y)-c[1])
+			glow += 120 * math.Exp(-d*d/40)
+		}
+		n := float64(rng.Intn(16))
+		return color.RGBA{
+			uint8(min(255, 40+glow+n)),
+			uint8(min(255, 60+float64(y)*6+glow/2)),
+			uint8(min(255, 160-float64(y)*4+n)),
+			0xFF,
+		}
+	})
+}
+
+// fixturePairs 返回测试使用的所有合成图片对：渐变、棋盘格、噪点和类似照片的场景。
+// 所有内容都由固定的公式和种子生成，每次运行完全相同，不需要提交二进制文件
+func fixturePairs() []fixturePair {
+	w, h := fixtureBounds.Dx(), fixtureBounds.Dy()
+	return []fixturePair{
+		{
+			Name:   "gradient",
+			Source: fixtureImage(func(x, y int) color.RGBA { v := uint8(x * 255 / (w - 1)); return color.RGBA{v, v, v, 0xFF} }),
+			Target: fixtureImage(func(x, y int) color.RGBA { v := uint8(y * 255 / (h - 1)); return color.RGBA{v, v / 2, 255 - v, 0xFF} }),
+		},
+		{
+			Name: "checker",
+			Source: fixtureImage(func(x, y int) color.RGBA {
+				if (x/4+y/4)%2 == 0 {
+					return color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+				}
+				return color.RGBA{0, 0, 0, 0xFF}
+			}),
+			Target: fixtureImage(func(x, y int) color.RGBA {
+				if (x/3+y/2)%2 == 0 {
+					return color.RGBA{0xC0, 0x20, 0x20, 0xFF}
+				}
+				return color.RGBA{0x20, 0x20, 0xC0, 0xFF}
+			}),
+		},
+		{Name: "noise", Source: noiseImage(1), Target: noiseImage(2)},
+		{Name: "scene", Source: sceneImage(3), Target: sceneImage(4)},
+	}
+}
+
+// checkPlanInvariants 检查计划是源图像和目标图像之间的一一对应：每个位置恰好是一个像素的起点和一个像素的终点，
+// 每个像素的颜色就是源图像中起点的颜色，并且按计划渲染的最后一帧在每个位置上都是到达该位置的像素的颜色
+func checkPlanInvariants(plan *AnimationPlan, sourceImg image.Image) error {
+	bounds := sourceImg.Bounds()
+	if plan.Bounds != bounds {
+		return fmt.Errorf("plan bounds %v, want %v", plan.Bounds, bounds)
+	}
+	if n := bounds.Dx() * bounds.Dy(); len(plan.Pixels) != n {
+		return fmt.Errorf("plan has %d pixels, want %d", len(plan.Pixels), n)
+	}
+	starts := map[image.Point]bool{}
+	targets := map[image.Point]color.RGBA{}
+	for _, ap := range plan.Pixels {
+		start, target := image.Pt(ap.StartX, ap.StartY), image.Pt(ap.TargetX, ap.TargetY)
+		if !start.In(bounds) || !target.In(bounds) {
+			return fmt.Errorf("pixel %v -> %v is outside %v", start, target, bounds)
+		}
+		if starts[start] {
+			return fmt.Errorf("two pixels start at %v", start)
+		}
+		if _, ok := targets[target]; ok {
+			return fmt.Errorf("two pixels end at %v", target)
+		}
+		if want := toRGBA(sourceImg.At(start.X, start.Y)); ap.Color != want {
+			return fmt.Errorf("pixel starting at %v has color %v, source has %v", start, ap.Color, want)
+		}
+		starts[start] = true
+		targets[target] = ap.Color
+	}
+	final := renderTarget(plan)
+	for p, c := range targets {
+		if got := final.RGBAAt(p.X, p.Y); got != c {
+			return fmt.Errorf("final frame at %v is %v, want %v", p, got, c)
+		}
+	}
+	return nil
+}
+
+// TestPlanInvariants 对每一对夹具图片运行每种算法，检查计划满足 checkPlanInvariants
+func TestPlanInvariants(t *testing.T) {
+	for _, fx := range fixturePairs() {
+		for _, name := range algorithmNames() {
+			t.Run(fx.Name+"/"+name, func(t *testing.T) {
+				plan := algorithms[name].Plan(fx.Source, fx.Target, PlanOptions{})
+				t.Logf("%d frames, mean travel %.2f", plan.Frames, TotalDistance(plan, Euclidean)/float64(len(plan.Pixels)))
+				if err := checkPlanInvariants(plan, fx.Source); err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	}
+}
+
+// benchBounds 是基准测试图片的尺寸，比夹具大得多，使分配和并行的开销可以测量
+var benchBounds = image.Rect(0, 0, 160, 120)
+
+// benchImage 生成 benchBounds 大小、固定种子的渐变加噪点图片
+func benchImage(seed int64) *image.RGBA {
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(benchBounds)
+	for y := benchBounds.Min.Y; y < benchBounds.Max.Y; y++ {
+		for x := benchBounds.Min.X; x < benchBounds.Max.X; x++ {
+			n := uint8(rng.Intn(32))
+			img.SetRGBA(x, y, color.RGBA{uint8(x) + n, uint8(y*2) + n, uint8(x+y) + n, 0xFF})
+		}
+	}
+	return img
+}
@@ -0,0 +1,541 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FrameOptions 控制动画帧的生成方式
+type FrameOptions struct {
+	// FrameStep 是每输出一帧前执行的移动次数，大于 1 时会折叠中间的运动以减少帧数
+	FrameStep int
+	// Motion 是像素的运动方式，见 newMotion，为空时使用 "random"
+	Motion string
+	// Seed 是 random 运动的随机种子，为 0 时使用当前时间，每次生成的动画都不同
+	Seed int64
+	// DebugBackground 为 "checker" 时，中间帧先填充品红/黑色的棋盘格再绘制像素，
+	// 运动过程中没有任何像素覆盖的格子会非常显眼，用于排查空洞和碰撞
+	DebugBackground string
+	// SkipSource 为 true 时不输出重建的源图像，动画从像素开始移动后的第一帧开始，因此永远不会显示原始的源图像
+	SkipSource bool
+	// MaxStep 大于 0 时限制 random 和 dither 运动每一步在每个轴上的最大移动距离。这两种运动的步长随图片尺寸放大，
+	// 大图片上像素每帧可能跳过很远、看起来不连贯；限制步长使运动更平滑，代价是需要更多帧
+	MaxStep int
+	// Flash 为 true 时，刚到达目标的像素在中间帧中显示为白色，之后 flashFrames 帧内逐渐恢复为原来的颜色，
+	// 用于观察收敛过程，也能得到闪烁的揭幕效果
+	Flash bool
+	// WaveWidth 是 wave 运动中每个像素的移动时长占整个动画的比例（0-1），越小各灰度的波次越分明、重叠越少，
+	// 为 0 时使用 defaultWaveWidth
+	WaveWidth float64
+	// Jitter 大于 0 时，中间帧中移动的像素被绘制在偏离路径的位置：沿垂直于起点到终点方向随机偏移最多 Jitter 个像素，
+	// 偏移量随剩余距离线性减小，到达目标时为 0。只影响绘制，不改变运动本身和帧数
+	Jitter float64
+	// Speed 大于 1 时每次移动的距离放大为 Speed 倍，像素沿同样的路线以更快的速度运动，需要的移动次数约为原来的 1/Speed。
+	// 与 FrameStep 不同，FrameStep 是对原速动画的抽帧，每一帧之间仍执行多次原来的移动
+	Speed int
+	// Context 不为 nil 时，RenderFrames 在生成每一帧之前检查它，被取消或超时后停止渲染并返回包装了 Context 错误的错误
+	Context context.Context
+	// Progress 不为 nil 时，RenderFrames 每输出一帧后以已到达目标位置的像素数调用它。前期的帧移动的像素多、后期的帧移动的像素少，
+	// 按到达的像素计算的进度比按帧数更接近实际的完成程度。只模拟运动（emit 为 nil）时不调用
+	Progress ProgressFunc
+}
+
+// ProgressFunc 报告渲染进度：arrived 是已到达目标位置的像素数，total 是计划中的像素总数
+type ProgressFunc func(arrived, total int)
+
+// defaultWaveWidth 是 wave 运动默认的移动时长比例
+const defaultWaveWidth = 0.3
+
+// flashFrames 是 Flash 效果中刚到达的像素从白色恢复为原色所需的帧数
+const flashFrames = 8
+
+// flashTint 把预乘 alpha 的颜色按比例 k（0-1）混向同一 alpha 下的白色
+func flashTint(c color.RGBA, k float64) color.RGBA {
+	mix := func(v uint8) uint8 { return uint8(float64(v) + (float64(c.A)-float64(v))*k + 0.5) }
+	return color.RGBA{mix(c.R), mix(c.G), mix(c.B), c.A}
+}
+
+// frameStepForLimit 返回使输出帧数不超过 maxFrames 所需的最小 FrameStep。
+// 除第一帧外，RenderFrames 最多执行 plan.Frames 次移动（最后一次用于确认全部到达），
+// 因此输出的帧数不超过 1 + ceil(plan.Frames/FrameStep)。maxFrames 小于 2 时返回 1
+func frameStepForLimit(plan *AnimationPlan, maxFrames int) int {
+	if maxFrames < 2 {
+		return 1
+	}
+	return max(1, (plan.Frames+maxFrames-2)/(maxFrames-1))
+}
+
+// speedForLimit 返回使输出帧数不超过 maxFrames 所需的最小 Speed。速度为 k 时所有像素在 ceil((plan.Frames-1)/k) 次移动内到达，
+// 每次移动输出一帧，另有首帧和确认全部到达时输出的末帧，因此帧数不超过 2 + ceil((plan.Frames-1)/k)。
+// 提速无法省掉首帧和末帧之外的最后一帧，maxFrames 小于 3 时返回 0，调用方应改用 frameStepForLimit
+func speedForLimit(plan *AnimationPlan, maxFrames int) int {
+	if maxFrames < 3 {
+		return 0
+	}
+	return max(1, (plan.Frames-1+maxFrames-3)/(maxFrames-2))
+}
+
+// capFrameCount 调整 opts，使按 opts 渲染 plan 输出的帧数不超过 maxFrames（至少为 2）：strategy 为 "speed" 时提高 Speed，
+// 提速无法满足时（或 strategy 为 "skip" 时）提高 FrameStep。speedForLimit 和 frameStepForLimit 只是按 plan.Frames 估计的起点，
+// dither 等运动的移动次数并不受 plan.Frames 限制，因此每次都模拟一遍运动确认帧数，仍然超过时继续提高。
+// opts.Seed 为 0 时 random 和 dither 运动每次运行的帧数不同，调用方应先固定种子
+func capFrameCount(plan *AnimationPlan, opts FrameOptions, maxFrames int, strategy string) (FrameOptions, error) {
+	if maxFrames < 2 {
+		return opts, fmt.Errorf("cannot limit an animation to %d frames", maxFrames)
+	}
+	frames, err := RenderFrames(plan, opts, nil)
+	if err != nil || frames <= maxFrames {
+		return opts, err
+	}
+	if strategy == "speed" {
+		// 速度超过计划的帧数后所有像素一次移动就能到达，再提速也不会减少帧数
+		for speed := speedForLimit(plan, maxFrames); speed > 1 && speed <= max(2, plan.Frames); speed = max(speed+1, speed*(frames-2)/(maxFrames-2)) {
+			opts.Speed = speed
+			if frames, err = RenderFrames(plan, opts, nil); err != nil || frames <= maxFrames {
+				return opts, err
+			}
+		}
+		opts.Speed = 1
+		frames, err = RenderFrames(plan, opts, nil)
+		if err != nil {
+			return opts, err
+		}
+	}
+	// FrameStep 超过移动次数后只剩首帧和末帧，因此循环总会结束
+	for step := max(opts.FrameStep+1, frameStepForLimit(plan, maxFrames)); frames > maxFrames; step = max(step+1, step*(frames-1)/(maxFrames-1)) {
+		opts.FrameStep = step
+		if frames, err = RenderFrames(plan, opts, nil); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// parseCapStrategy 检查 -cap-strategy 的取值："speed" 用 Speed 加快运动，"skip" 用 FrameStep 对原速动画抽帧
+func parseCapStrategy(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case "", "speed":
+		return "speed", nil
+	case "skip":
+		return "skip", nil
+	default:
+		return "", fmt.Errorf("unknown cap strategy: %s. Please use 'speed' or 'skip'", s)
+	}
+}
+
+// checkerMagenta 是 DebugBackground 棋盘格中的品红色
+var checkerMagenta = color.RGBA{0xFF, 0x00, 0xFF, 0xFF}
+
+// fillChecker 用逐像素交替的品红和黑色填充图像
+func fillChecker(img *image.RGBA) {
+	magenta := checkerMagenta
+	black := color.RGBA{0x00, 0x00, 0x00, 0xFF}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if (x+y)%2 == 0 {
+				img.SetRGBA(x, y, magenta)
+			} else {
+				img.SetRGBA(x, y, black)
+			}
+		}
+	}
+}
+
+// framePool 缓存中间帧使用的 RGBA 缓冲区。数百帧的动画每一帧都分配一整张图像会带来很大的 GC 压力，
+// 而帧在转换为调色板图像后就不再需要，可以交还给池复用
+var framePool sync.Pool
+
+// getFrame 返回一张尺寸为 bounds、所有像素都为 0 的 RGBA 图像，优先复用 releaseFrame 交还的缓冲区
+func getFrame(bounds image.Rectangle) *image.RGBA {
+	if img, ok := framePool.Get().(*image.RGBA); ok {
+		if img.Rect == bounds {
+			clear(img.Pix)
+			return img
+		}
+	}
+	return image.NewRGBA(bounds)
+}
+
+// releaseFrame 把不再使用的帧交还给 framePool。调用之后不能再访问 img
+func releaseFrame(img *image.RGBA) {
+	framePool.Put(img)
+}
+
+// pixelState 存储一个像素在动画中的当前位置
+type pixelState struct {
+	X, Y int
+	// PX, PY 和 VX, VY 是 gravity 运动使用的连续位置和速度
+	PX, PY, VX, VY float64
+}
+
+// motionFunc 把一个尚未到达目标的像素向目标移动一步，step 是从 1 开始的移动次数
+type motionFunc func(ap AnimationPixel, state *pixelState, step int)
+
+// newMotion 根据名称创建运动方式，speed 大于 1 时每次移动的距离放大为 speed 倍（见 FrameOptions.Speed），seed 是 random 和 dither 运动的随机种子（为 0 时使用当前时间），
+// maxStep 大于 0 时限制这两种运动每步的最大移动距离，waveWidth 是 wave 运动的移动时长比例：
+//   - random: 每步在两个轴上分别随机移动 1-3 个单位（按图片尺寸缩放），先到达的轴停止移动
+//   - dither: 步长与 random 相同，次轴按剩余距离之比随机前进，像素大致沿直线运动
+//   - deterministic: 沿 Bresenham 直线每步在主轴方向上移动 1 个单位，不使用随机数，输出完全可复现
+//   - line: 沿 Bresenham 直线匀速运动，所有像素在 plan.Frames 帧内同时到达
+//   - gravity: 像素从静止开始加速，被临界阻尼的弹簧拉向目标，在 plan.Frames 帧内停在目标上
+//   - wave: 按颜色的灰度从暗到亮依次出发，每个像素用相同的时长沿直线走完，相邻灰度的波次相互重叠
+func newMotion(name string, plan *AnimationPlan, seed int64, maxStep int, waveWidth float64, speed int) (motionFunc, error) {
+	speed = max(1, speed)
+	// line、gravity 和 wave 按总步数安排整个运动，提速时把总步数缩短为 1/speed
+	total := max(1, (plan.Frames-1+speed-1)/speed)
+	switch strings.ToLower(name) {
+	case "", "random":
+		return randomMotion(plan, seed, maxStep, speed), nil
+	case "dither":
+		return ditherMotion(plan, seed, maxStep, speed), nil
+	case "deterministic":
+		return func(ap AnimationPixel, state *pixelState, step int) {
+			deterministicMotion(ap, state, step*speed)
+		}, nil
+	case "line":
+		return lineMotion(total), nil
+	case "gravity":
+		return gravityMotion(total), nil
+	case "wave":
+		if waveWidth < 0 || waveWidth > 1 {
+			return nil, fmt.Errorf("invalid wave width %g: must be between 0 and 1", waveWidth)
+		}
+		return waveMotion(plan, total, waveWidth), nil
+	default:
+		return nil, fmt.Errorf("unknown motion: %s. Please use 'random', 'dither', 'deterministic', 'line', 'gravity' or 'wave'", name)
+	}
+}
+
+// randomMotion 返回随机步长的运动方式，每次调用使用各自的随机数生成器。步长（限制在 maxStep 之内后）再乘以 speed
+func randomMotion(plan *AnimationPlan, seed int64, maxStep, speed int) motionFunc {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	// 根据图片尺寸计算缩放因子
+	scaleX := float64(plan.Bounds.Dx()) / 150.0
+	scaleY := float64(plan.Bounds.Dy()) / 150.0
+
+	return func(ap AnimationPixel, state *pixelState, step int) {
+		// 获取随机步长（基础步长 1-3，按图片尺寸缩放）
+		stepX := randomStep(rng, scaleX, maxStep) * speed
+		stepY := randomStep(rng, scaleY, maxStep) * speed
+
+		// 分别移动 X 轴和 Y 轴
+		state.X = stepToward(state.X, ap.TargetX, stepX)
+		state.Y = stepToward(state.Y, ap.TargetY, stepY)
+	}
+}
+
+// randomStep 返回 1-3 的随机基础步长乘以 scale 的结果，并确保至少为 1；maxStep 大于 0 时不超过 maxStep
+func randomStep(rng *rand.Rand, scale float64, maxStep int) int {
+	base := rng.Intn(3) + 1
+	step := max(1, int(scale), int(math.Round(float64(base)*scale)))
+	if maxStep > 0 {
+		step = min(step, maxStep)
+	}
+	return step
+}
+
+// stepToward 从 pos 向 target 移动 step 个单位，距离不足 step 时直接到达
+func stepToward(pos, target, step int) int {
+	switch d := target - pos; {
+	case abs(d) <= step:
+		return target
+	case d > 0:
+		return pos + step
+	default:
+		return pos - step
+	}
+}
+
+// ditherMotion 返回带方向抖动的随机运动：步长与 random 相同，但每一步只保证在剩余距离较长的主轴上前进，
+// 次轴以“次轴剩余距离/主轴剩余距离”的概率前进。random 运动中两个轴同时前进，较短的轴先走完，
+// 像素沿 L 形路线运动，大量像素在同一时刻转弯和到达，形成明显的斜向条带；
+// 这里每个像素大致沿直线前进，转折和到达的时刻被随机打散
+func ditherMotion(plan *AnimationPlan, seed int64, maxStep, speed int) motionFunc {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+	scaleX := float64(plan.Bounds.Dx()) / 150.0
+	scaleY := float64(plan.Bounds.Dy()) / 150.0
+
+	return func(ap AnimationPixel, state *pixelState, step int) {
+		dx := abs(ap.TargetX - state.X)
+		dy := abs(ap.TargetY - state.Y)
+		stepX := randomStep(rng, scaleX, maxStep) * speed
+		stepY := randomStep(rng, scaleY, maxStep) * speed
+		if dx >= dy {
+			state.X = stepToward(state.X, ap.TargetX, stepX)
+			if rng.Intn(dx) < dy {
+				state.Y = stepToward(state.Y, ap.TargetY, stepY)
+			}
+		} else {
+			state.Y = stepToward(state.Y, ap.TargetY, stepY)
+			if rng.Intn(dy) < dx {
+				state.X = stepToward(state.X, ap.TargetX, stepX)
+			}
+		}
+	}
+}
+
+// deterministicMotion 让像素沿 Bresenham 直线每步在主轴上前进 1 个单位，
+// 因此每个像素恰好在 max(|dx|, |dy|) 步后到达目标
+func deterministicMotion(ap AnimationPixel, state *pixelState, step int) {
+	state.X, state.Y = lineStep(ap.StartX, ap.StartY, ap.TargetX, ap.TargetY, step)
+}
+
+// lineMotion 返回沿直线匀速运动的方式：每个像素都用 total 步（通常为 plan.Frames-1）走完自己的直线，
+// 距离短的像素移动得慢，所有像素同时到达
+func lineMotion(total int) motionFunc {
+	return func(ap AnimationPixel, state *pixelState, step int) {
+		state.X, state.Y = bresenhamPoint(ap.StartX, ap.StartY, ap.TargetX, ap.TargetY, step, total)
+	}
+}
+
+// gravityMotion 返回弹簧运动：每个像素受到指向目标的弹簧力和阻尼力，从静止开始加速，再逐渐减速停在目标上。
+// 弹簧是临界阻尼的，不会越过目标来回振荡；角频率按总步数 total（通常为 plan.Frames-1）选取，使剩余距离在最后一步之前衰减到不足千分之三，
+// 最后一步再精确地放到目标上。每一步拆分为若干个子步积分，保证数值稳定
+func gravityMotion(total int) motionFunc {
+	omega := 8.0 / float64(total)
+	substeps := max(1, int(math.Ceil(omega/0.1)))
+	dt := 1.0 / float64(substeps)
+
+	return func(ap AnimationPixel, state *pixelState, step int) {
+		if step >= total {
+			state.X, state.Y = ap.TargetX, ap.TargetY
+			return
+		}
+		if step == 1 {
+			state.PX, state.PY = float64(ap.StartX), float64(ap.StartY)
+			state.VX, state.VY = 0, 0
+		}
+		tx, ty := float64(ap.TargetX), float64(ap.TargetY)
+		for i := 0; i < substeps; i++ {
+			// 半隐式欧拉积分：先更新速度，再用新速度更新位置
+			state.VX += (omega*omega*(tx-state.PX) - 2*omega*state.VX) * dt
+			state.VY += (omega*omega*(ty-state.PY) - 2*omega*state.VY) * dt
+			state.PX += state.VX * dt
+			state.PY += state.VY * dt
+		}
+		state.X, state.Y = int(math.Round(state.PX)), int(math.Round(state.PY))
+	}
+}
+
+// waveMotion 返回按灰度分波次的运动：像素按颜色的灰度从暗到亮排名，出发的时刻与排名成正比，
+// 每个像素都用 width*total 步沿直线匀速走完，最亮的像素恰好在第 total 步（通常为 plan.Frames-1）到达。
+// width 越接近 1，各波次重叠越多，为 1 时与 line 相同
+func waveMotion(plan *AnimationPlan, total int, width float64) motionFunc {
+	if width <= 0 {
+		width = defaultWaveWidth
+	}
+	duration := max(1, min(total, int(math.Round(width*float64(total)))))
+
+	// 起点在计划中是唯一的，用它找到每个像素的灰度排名（plan.Descending 时从亮到暗）
+	order := make([]int, len(plan.Pixels))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		if plan.Descending {
+			a, b = b, a
+		}
+		return grayscaleOf(plan.Pixels[order[a]].Color) < grayscaleOf(plan.Pixels[order[b]].Color)
+	})
+	delays := make(map[image.Point]int, len(order))
+	last := max(1, len(order)-1)
+	for rank, i := range order {
+		ap := plan.Pixels[i]
+		delays[image.Pt(ap.StartX, ap.StartY)] = (total - duration) * rank / last
+	}
+
+	return func(ap AnimationPixel, state *pixelState, step int) {
+		elapsed := step - delays[image.Pt(ap.StartX, ap.StartY)]
+		if elapsed <= 0 {
+			return
+		}
+		state.X, state.Y = bresenhamPoint(ap.StartX, ap.StartY, ap.TargetX, ap.TargetY, elapsed, duration)
+	}
+}
+
+// bresenhamPoint 返回在 total 步内走完从 (x0, y0) 到 (x1, y1) 的 Bresenham 直线时，第 step 步所在的点。
+// 直线上的点按 step/total 的比例选取，step >= total 时返回终点
+func bresenhamPoint(x0, y0, x1, y1, step, total int) (int, int) {
+	if total <= 0 || step >= total {
+		return x1, y1
+	}
+	n := max(abs(x1-x0), abs(y1-y0))
+	return lineStep(x0, y0, x1, y1, roundDiv(n*step, total))
+}
+
+// lineStep 返回从 (x0, y0) 到 (x1, y1) 的 Bresenham 直线上第 i 个点，
+// 主轴坐标每个点前进 1，副轴坐标取最接近直线的整数；i 超过直线长度时返回终点
+func lineStep(x0, y0, x1, y1, i int) (int, int) {
+	dx, dy := x1-x0, y1-y0
+	n := max(abs(dx), abs(dy))
+	if i >= n {
+		return x1, y1
+	}
+	if i <= 0 {
+		return x0, y0
+	}
+	return x0 + roundDiv(dx*i, n), y0 + roundDiv(dy*i, n)
+}
+
+// roundDiv 返回 a/b 四舍五入后的整数（b > 0），负数时向零方向对称舍入
+func roundDiv(a, b int) int {
+	if a < 0 {
+		return -((-a*2 + b) / (2 * b))
+	}
+	return (a*2 + b) / (2 * b)
+}
+
+// jitterOffset 返回像素在当前位置绘制时的随机偏移：方向垂直于从起点到终点的直线，大小在 ±amount 之间随机选取，
+// 再乘以剩余距离占总距离的比例，因此越接近目标偏移越小，到达目标时为 0
+func jitterOffset(rng *rand.Rand, ap AnimationPixel, state pixelState, amount float64) (int, int) {
+	vx, vy := float64(ap.TargetX-ap.StartX), float64(ap.TargetY-ap.StartY)
+	total := math.Hypot(vx, vy)
+	if total == 0 {
+		return 0, 0
+	}
+	remaining := math.Hypot(float64(ap.TargetX-state.X), float64(ap.TargetY-state.Y))
+	r := (rng.Float64()*2 - 1) * amount * min(1, remaining/total)
+	return int(math.Round(-vy / total * r)), int(math.Round(vx / total * r))
+}
+
+// RenderFrames 按顺序生成动画的每一帧，并对每一帧调用 emit，返回生成的帧数。
+// 第一帧是重建的源图像（设置了 SkipSource 时跳过），最后一帧是所有像素都已到达目标位置的图像。
+// emit 获得帧的所有权，RenderFrames 之后不会再修改它。emit 为 nil 时只模拟运动并统计帧数，不渲染任何帧
+func RenderFrames(plan *AnimationPlan, opts FrameOptions, emit func(frame *image.RGBA)) (int, error) {
+	move, err := newMotion(opts.Motion, plan, opts.Seed, opts.MaxStep, opts.WaveWidth, opts.Speed)
+	if err != nil {
+		return 0, err
+	}
+	frameStep := max(1, opts.FrameStep)
+
+	// 存储每个像素的当前位置，arrived 是已在目标位置上的像素数
+	pixelStates := make([]pixelState, len(plan.Pixels))
+	arrived := 0
+	for i, p := range plan.Pixels {
+		pixelStates[i] = pixelState{X: p.StartX, Y: p.StartY}
+		if p.StartX == p.TargetX && p.StartY == p.TargetY {
+			arrived++
+		}
+	}
+	progress := func() {
+		if opts.Progress != nil && emit != nil {
+			opts.Progress(arrived, len(plan.Pixels))
+		}
+	}
+	// arrivals 记录 Flash 效果中每个像素到达目标时的帧号，一开始就在目标上的像素不闪烁
+	var arrivals []int
+	if opts.Flash {
+		arrivals = make([]int, len(plan.Pixels))
+		for i := range arrivals {
+			arrivals[i] = -flashFrames
+		}
+	}
+
+	// jitterRNG 是 Jitter 效果使用的随机数生成器，与运动的随机数分开，因此不会改变像素的运动
+	var jitterRNG *rand.Rand
+	if opts.Jitter > 0 {
+		seed := opts.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		jitterRNG = rand.New(rand.NewSource(seed))
+	}
+
+	frameCount := 1 // 从第1帧开始计数（因为第0帧已经是原图）
+	moves := 0      // 已执行的移动次数
+
+	// 首先，将原图作为第一帧
+	if opts.SkipSource {
+		frameCount = 0
+	} else if emit != nil {
+		emit(renderStart(plan))
+		progress()
+	}
+
+	for {
+		if opts.Context != nil {
+			if err := opts.Context.Err(); err != nil {
+				return frameCount, fmt.Errorf("rendering stopped after %d frames: %w", frameCount, err)
+			}
+		}
+		frameCount++
+		allArrived := true
+
+		// 每输出一帧之前执行 frameStep 次移动，全部到达后提前结束
+		for step := 0; step < frameStep; step++ {
+			allArrived = true
+			moves++
+			for i, ap := range plan.Pixels {
+				state := &pixelStates[i]
+
+				// 如果已经到达，就不再移动
+				if state.X == ap.TargetX && state.Y == ap.TargetY {
+					continue
+				}
+				allArrived = false
+				move(ap, state, moves)
+				if state.X == ap.TargetX && state.Y == ap.TargetY {
+					arrived++
+					if arrivals != nil {
+						arrivals[i] = frameCount
+					}
+				}
+			}
+			if allArrived {
+				break
+			}
+		}
+
+		if allArrived {
+			// 最后一帧所有像素都在目标位置（分块计划则是全分辨率的目标图像）
+			if emit != nil {
+				emit(renderTarget(plan))
+				progress()
+			}
+			return frameCount, nil
+		}
+		if emit == nil {
+			continue
+		}
+
+		currentFrameRGBA := getFrame(plan.Bounds)
+		if opts.DebugBackground == "checker" {
+			fillChecker(currentFrameRGBA)
+		}
+		for i, ap := range plan.Pixels {
+			c := ap.Color
+			if arrivals != nil {
+				if age := frameCount - arrivals[i]; age < flashFrames {
+					c = flashTint(c, 1-float64(age)/flashFrames)
+				}
+			}
+			x, y := pixelStates[i].X, pixelStates[i].Y
+			if jitterRNG != nil && (x != ap.TargetX || y != ap.TargetY) {
+				dx, dy := jitterOffset(jitterRNG, ap, pixelStates[i], opts.Jitter)
+				// 偏移后超出画面的像素仍画在原来的位置
+				if p := image.Pt(x+dx, y+dy); p.In(plan.Bounds) {
+					x, y = p.X, p.Y
+				}
+			}
+			currentFrameRGBA.SetRGBA(x, y, c)
+		}
+		emit(expandBlocks(plan, currentFrameRGBA))
+		progress()
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"testing"
+)
+
+// TestCapFrameCount 检查两种 -cap-strategy 对每种运动都能把帧数限制在 maxFrames 之内，
+// 包括移动次数不受 plan.Frames 限制的 dither 运动
+func TestCapFrameCount(t *testing.T) {
+	for _, fx := range fixturePairs() {
+		plan := CreateAnimationPlan(fx.Source, fx.Target, PlanOptions{})
+		for _, motion := range selftestMotions {
+			for _, strategy := range []string{"speed", "skip"} {
+				for _, maxFrames := range []int{2, 3, 5, 10} {
+					name := fmt.Sprintf("%s/%s/%s/%d", fx.Name, motion, strategy, maxFrames)
+					t.Run(name, func(t *testing.T) {
+						opts := FrameOptions{Motion: motion, Seed: 1}
+						capped, err := capFrameCount(plan, opts, maxFrames, strategy)
+						if err != nil {
+							t.Fatal(err)
+						}
+						frames, err := RenderFrames(plan, capped, nil)
+						if err != nil {
+							t.Fatal(err)
+						}
+						if frames > maxFrames {
+							t.Errorf("%d frames with speed %d and frame step %d, want at most %d", frames, capped.Speed, capped.FrameStep, maxFrames)
+						}
+						// 限制帧数不能破坏动画：最后一帧仍然是完整的目标图像
+						var last *image.RGBA
+						if _, err := RenderFrames(plan, capped, func(frame *image.RGBA) { last = frame }); err != nil {
+							t.Fatal(err)
+						}
+						if !last.Bounds().Eq(plan.Bounds) || !bytes.Equal(last.Pix, renderTarget(plan).Pix) {
+							t.Errorf("the last frame is not the target image")
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkRenderFrames 比较 emit 把帧交还给 framePool（与 GIF 编码器相同）和不交还时每次渲染的分配次数和字节数
+func BenchmarkRenderFrames(b *testing.B) {
+	plan := CreateAnimationPlan(benchImage(1), benchImage(2), PlanOptions{})
+	opts := FrameOptions{Motion: "deterministic"}
+	for _, bc := range []struct {
+		name string
+		emit func(frame *image.RGBA)
+	}{
+		{"pooled", releaseFrame},
+		{"unpooled", func(*image.RGBA) {}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := RenderFrames(plan, opts, bc.emit); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestBresenhamPoint 检查 bresenhamPoint 在水平、陡峭、负斜率和零长度的直线上逐步返回的点
+func TestBresenhamPoint(t *testing.T) {
+	tests := []struct {
+		name           string
+		x0, y0, x1, y1 int
+		total          int
+		want           []image.Point // 第 0 步到第 total 步的点
+	}{
+		{"horizontal", 0, 0, 4, 0, 4, []image.Point{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}}},
+		{"horizontal reversed", 4, 2, 0, 2, 4, []image.Point{{4, 2}, {3, 2}, {2, 2}, {1, 2}, {0, 2}}},
+		{"horizontal in fewer steps", 0, 0, 4, 0, 2, []image.Point{{0, 0}, {2, 0}, {4, 0}}},
+		{"steep", 0, 0, 2, 6, 6, []image.Point{{0, 0}, {0, 1}, {1, 2}, {1, 3}, {1, 4}, {2, 5}, {2, 6}}},
+		{"negative slope", 0, 0, 4, -2, 4, []image.Point{{0, 0}, {1, -1}, {2, -1}, {3, -2}, {4, -2}}},
+		{"steep negative slope", 1, 6, 0, 0, 6, []image.Point{{1, 6}, {1, 5}, {1, 4}, {0, 3}, {0, 2}, {0, 1}, {0, 0}}},
+		{"zero length", 3, 5, 3, 5, 3, []image.Point{{3, 5}, {3, 5}, {3, 5}, {3, 5}}},
+		{"zero steps", 1, 1, 5, 3, 0, []image.Point{{5, 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for step, want := range tt.want {
+				x, y := bresenhamPoint(tt.x0, tt.y0, tt.x1, tt.y1, step, tt.total)
+				if got := image.Pt(x, y); got != want {
+					t.Errorf("step %d/%d: got %v, want %v", step, tt.total, got, want)
+				}
+			}
+			// 超过 total 的步数停在终点
+			if x, y := bresenhamPoint(tt.x0, tt.y0, tt.x1, tt.y1, tt.total+1, tt.total); x != tt.x1 || y != tt.y1 {
+				t.Errorf("step past total: got (%d,%d), want (%d,%d)", x, y, tt.x1, tt.y1)
+			}
+		})
+	}
+}
+
+// TestBresenhamPointConnected 检查步数等于直线长度时相邻两步的点是 8 连通的，并且负方向的直线与正方向的直线对称
+func TestBresenhamPointConnected(t *testing.T) {
+	for _, end := range []image.Point{{7, 3}, {3, 7}, {-7, 3}, {3, -7}, {-5, -5}, {9, 0}, {0, -9}} {
+		n := max(abs(end.X), abs(end.Y))
+		px, py := 0, 0
+		for step := 1; step <= n; step++ {
+			x, y := bresenhamPoint(0, 0, end.X, end.Y, step, n)
+			if abs(x-px) > 1 || abs(y-py) > 1 {
+				t.Errorf("line to %v: step %d jumps from (%d,%d) to (%d,%d)", end, step, px, py, x, y)
+			}
+			if mx, my := bresenhamPoint(0, 0, -end.X, -end.Y, step, n); mx != -x || my != -y {
+				t.Errorf("line to %v: step %d is (%d,%d), mirrored line gives (%d,%d)", end, step, x, y, mx, my)
+			}
+			px, py = x, y
+		}
+	}
+}
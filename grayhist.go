@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"strconv"
+)
+
+// grayHistogram 把图像每个像素的灰度值（与排序使用的 grayscaleOf 相同）分到 buckets 个等宽区间中，返回每个区间的像素数
+func grayHistogram(img image.Image, buckets int) []int {
+	counts := make([]int, buckets)
+	for p := range imagePixels(img) {
+		b := min(int(p.GrayscaleValue*float64(buckets)/256), buckets-1)
+		counts[b]++
+	}
+	return counts
+}
+
+// SaveGrayHistogram 把源图像和目标图像的灰度分布写成 CSV 文件（见 WriteGrayHistogram）
+func SaveGrayHistogram(sourceImg, targetImg image.Image, buckets int, outputPath string) error {
+	if buckets < 1 || buckets > 256 {
+		return fmt.Errorf("invalid bucket count %d: must be between 1 and 256", buckets)
+	}
+	log.Printf("正在将灰度分布写入 %s...", outputPath)
+	return saveToFile(outputPath, func(w io.Writer) error {
+		return WriteGrayHistogram(w, sourceImg, targetImg, buckets)
+	})
+}
+
+// WriteGrayHistogram 把源图像和目标图像的灰度分布按区间以 CSV 格式写入 w：每行是一个区间的下界、上界（不含）
+// 以及两张图像落在该区间中的像素数，第一行是表头
+func WriteGrayHistogram(w io.Writer, sourceImg, targetImg image.Image, buckets int) error {
+	if buckets < 1 || buckets > 256 {
+		return fmt.Errorf("invalid bucket count %d: must be between 1 and 256", buckets)
+	}
+	source := grayHistogram(sourceImg, buckets)
+	target := grayHistogram(targetImg, buckets)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"gray_from", "gray_to", "source", "target"})
+	width := 256.0 / float64(buckets)
+	for i := 0; i < buckets; i++ {
+		cw.Write([]string{
+			strconv.FormatFloat(float64(i)*width, 'f', -1, 64),
+			strconv.FormatFloat(float64(i+1)*width, 'f', -1, 64),
+			strconv.Itoa(source[i]),
+			strconv.Itoa(target[i]),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -1,82 +1,362 @@
+//go:build !(js && wasm)
+
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"image"
-	_ "image/jpeg" // 导入 JPEG 解码器以支持解码
-	_ "image/png"  // 导入 PNG 解码器以支持解码
+	"image/color"
+	"io"
 	"log"
 	"math"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"text/template"
+	"time"
 )
 
-// readImage 从指定路径读取图片
-func readImage(filePath string) (image.Image, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open image file %s: %w", filePath, err)
-	}
-	defer file.Close()
-
-	img, _, err := image.Decode(file)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode image file %s: %w", filePath, err)
-	}
-	return img, nil
-}
-
 func main() {
+	// 命令名之前的全局选项，解析后从 os.Args 中去掉，各命令仍从 os.Args[2:] 解析自己的选项
+	global := flag.NewFlagSet("img2video", flag.ExitOnError)
+	global.Usage = printUsage
+	cpuProfile := global.String("cpuprofile", "", "write a CPU profile to this file")
+	memProfile := global.String("memprofile", "", "write a heap profile to this file on exit")
+	global.Parse(os.Args[1:])
+	os.Args = append(os.Args[:1], global.Args()...)
+
 	if len(os.Args) < 2 {
 		printUsage()
-		os.Exit(1)
+		exit(1)
 	}
 
+	stop, err := startProfiling(*cpuProfile, *memProfile)
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+	stopProfiling = stop
+	defer stopProfiling()
+
+	// 只有使用配置的命令才读取配置文件，格式错误的配置文件不影响 algorithms、completion 等命令
 	command := os.Args[1]
 	switch command {
-	case "gif", "image":
-		handleGenerate(command)
+	case "gif", "image", "endpoints", "montage", "fade", "text":
+		handleGenerate(command, mustLoadConfig())
 	case "analyze":
-		handleAnalyze()
+		handleAnalyze(mustLoadConfig())
+	case "compare-algos":
+		handleCompareAlgos(mustLoadConfig())
+	case "chain":
+		handleChain(mustLoadConfig())
+	case "snake":
+		handleSnake(mustLoadConfig())
+	case "dissolve":
+		handleDissolve(mustLoadConfig())
+	case "video":
+		handleVideo(mustLoadConfig())
+	case "grayhist":
+		handleGrayHist(mustLoadConfig())
+	case "sortstrip":
+		handleSortStrip(mustLoadConfig())
+	case "diffplan":
+		handleDiffPlan()
+	case "algorithms":
+		printAlgorithms()
+	case "tui":
+		handleTUI(mustLoadConfig())
+	case "selftest":
+		handleSelftest()
+	case "completion":
+		handleCompletion()
 	default:
 		fmt.Printf("Unknown command: %s\n", command)
 		printUsage()
-		os.Exit(1)
+		exit(1)
+	}
+}
+
+// mustLoadConfig 读取配置文件和环境变量中的默认选项（见 loadConfig），出错时退出。
+// 只是查看命令的帮助（-h）时不退出，只给出警告并使用默认配置，completion 命令也依靠 -h 列出每个命令的选项
+func mustLoadConfig() Config {
+	cfg, cfgPath, err := loadConfig()
+	if err != nil && wantsHelp(os.Args[2:]) {
+		log.Printf("Warning: %v; showing the built-in defaults.", err)
+		return defaultConfig()
+	}
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+	if cfgPath != "" {
+		log.Printf("Using config file: %s", cfgPath)
+	}
+	return cfg
+}
+
+// wantsHelp 判断命令行参数中是否有 flag 包识别的帮助选项
+func wantsHelp(args []string) bool {
+	for _, arg := range args {
+		switch arg {
+		case "-h", "-help", "--h", "--help":
+			return true
+		}
 	}
+	return false
 }
 
 func printUsage() {
-	fmt.Println("Usage: img2video <command> [arguments]")
+	fmt.Println("Usage: img2video [-cpuprofile file] [-memprofile file] <command> [arguments]")
 	fmt.Println("\nCommands:")
 	fmt.Println("  gif <source> <target> <output.gif> [algorithm] [delay] - Generate a GIF animation")
 	fmt.Println("  image <source> <target> <output.png> [algorithm]     - Generate a single result image")
+	fmt.Println("  endpoints <source> <target> <prefix> [algorithm]     - Save the reconstructed first and last frames as PNGs")
+	fmt.Println("  montage <source> <target> <output.png> [algorithm]   - Save source, target and result side by side")
+	fmt.Println("  fade <source> <#color> <output.gif> [algorithm] [delay] - Generate a GIF toward a solid color")
+	fmt.Println("  text <from> <to> <output.gif> [algorithm] [delay]   - Morph between two strings drawn with the built-in font")
+	fmt.Println("  dissolve <source> <target> <output.gif> [frames]     - Cross-fade colors in place without moving pixels")
+	fmt.Println("  snake <target> <output.gif> [frames]                 - Draw the image along a Hilbert or boustrophedon curve")
+	fmt.Println("  chain <output.gif> <image1> <image2> [image3...]     - Morph through several images in one GIF")
+	fmt.Println("  video <source> <target> <output.mp4> [algorithm]     - Encode the animation as a video with ffmpeg")
+	fmt.Println("                                                         (output - or *.mjpeg writes a Motion-JPEG stream instead)")
+	fmt.Println("  compare-algos <source> <target> <output.png>           - Save every algorithm's result side by side in a grid")
+	fmt.Println("  grayhist <source> <target> <output.csv>                - Export the grayscale distributions of both images as CSV")
+	fmt.Println("  sortstrip <image> <output.png> [algorithm]             - Lay out the image's pixels in sorted order as a strip")
+	fmt.Println("  diffplan <a.json> <b.json>                             - Count pixels whose target differs between two saved plans")
 	fmt.Println("  analyze <source> <target> [algorithm]                  - Analyze grayscale sums before and after reordering")
-	fmt.Println("\nAlgorithm can be 'default' or 'featured' (default: default).")
+	fmt.Println("  tui <source> <target> [algorithm]                      - Preview the animation frame by frame in the terminal")
+	fmt.Println("  algorithms                                             - List the available algorithms")
+	fmt.Println("  selftest                                               - Run a built-in end-to-end check of every algorithm")
+	fmt.Println("  completion <bash|zsh|fish>                             - Print a shell completion script")
+	fmt.Printf("\nAlgorithm can be one of: %s (default: default).\n", strings.Join(algorithmNames(), ", "))
+	fmt.Println("\nOptions (must precede the positional arguments):")
+	fmt.Println("  -palette <name>  GIF palette: plan9, websafe, gray, adaptive or source (default: plan9)")
+	fmt.Println("  -palette-from <f> Build the GIF palette from style image f by median cut (overrides -palette)")
+	fmt.Println("  -dither <mode>   GIF dithering: none, floyd or serpentine (default: none)")
+	fmt.Println("  -outsize <WxH>   Scale the GIF frames or result image to WxH; the morph still runs at full resolution")
+	fmt.Println("  -fit             With -outsize, keep the aspect ratio and fit inside WxH")
+	fmt.Println("  -no-first-frame-source  Start the GIF already in motion; it never shows the pristine source")
+	fmt.Println("  -loopdelay <n>   Delay of the last GIF frame in 1/100 s, so the final image lingers before each loop (gif, chain)")
+	fmt.Println("  -trim            Merge identical consecutive GIF frames, summing their delays")
+	fmt.Println("  -lossy <n>       Drop n low bits (0-7) of each color channel before quantizing, for smaller GIFs")
+	fmt.Println("  -maxpixels <n>   Refuse input images with more than n pixels, 0 disables (default: 16777216)")
+	fmt.Println("  -json            analyze: print the grayscale sum comparison as JSON")
+	fmt.Println("  -distance <m>    Travel distance metric reported by analyze: euclidean, manhattan or chebyshev")
+	fmt.Println("  -compare-all     analyze: print frames, travel and estimated GIF size of every algorithm as a table")
+	fmt.Println("  -framestep <n>   Movement steps per emitted GIF frame; larger values give shorter GIFs (default: 1)")
+	fmt.Println("  -stats           Also write render statistics (frames, size, travel, seed, time) to <output>.stats.json")
+	fmt.Println("  -timeout <d>     gif, fade, text, video: abort the render if it takes longer than d, e.g. 30s (default: 0, no limit)")
+	fmt.Println("  -explain         Print a summary (algorithm, pixels, frames, palette, motion, seed, size) to stderr first")
+	fmt.Println("  -saveplan <f>    Also write the animation plan (every pixel's start, target and color) as JSON to file f")
+	fmt.Println("  -timestamps <f>  Also write the GIF frame timestamps (mkvmerge v2 format) to file f")
+	fmt.Println("  -duration <d>    Choose the frame delay so the GIF lasts about d (e.g. 3s), skipping frames if needed")
+	fmt.Println("  -maxframes <n>   Speed up the motion or skip frames so the GIF has at most n frames (default: 0, no limit)")
+	fmt.Println("  -cap-strategy <s> How -maxframes is enforced: speed (faster motion) or skip (raise -framestep) (default: speed)")
+	fmt.Println("  -motion <name>   Pixel motion: random, dither, deterministic, line, gravity or wave (default: random)")
+	fmt.Println("  -flash           Flash pixels white as they arrive, fading back to their color over 8 frames")
+	fmt.Println("  -maxstep <n>     Cap each step of the random and dither motions at n pixels (default: 0, no cap)")
+	fmt.Println("  -wavewidth <f>   Fraction of the animation each pixel spends moving in the wave motion (default: 0.3)")
+	fmt.Println("  -jitter <px>     Wobble moving pixels up to px pixels off their path, fading out as they arrive")
+	fmt.Println("  -boomerang       Play the GIF forward and then backward back to the source")
+	fmt.Println("  -invert-return   With -boomerang, invert the colors of the backward leg")
+	fmt.Println("  -blocksize <n>   Move NxN pixel blocks as units; the last frame is the full-resolution target")
+	fmt.Println("  -mask <file>     Only pixels under white areas of this mask image move; black areas stay fixed")
+	fmt.Println("  -changed-only    Only pixels that differ between source and target move; identical ones stay fixed")
+	fmt.Println("  -anchors <list>  Pin the pixels at x1,y1;x2,y2;... in place; they are rendered as static background")
+	fmt.Println("  -alphathreshold <t> Only source pixels with alpha >= t move; the others stay fixed as background")
+	fmt.Println("  -seed <n>        Random seed for the shuffle algorithm (default: 1)")
+	fmt.Println("  -threshmin <g>   Lowest grayscale (0-255) sorted by the threshold algorithm (default: 64)")
+	fmt.Println("  -threshmax <g>   Highest grayscale (0-255) sorted by the threshold algorithm (default: 192)")
+	fmt.Println("  -sortdesc        Sort pixels from bright to dark; highlights lead the wave motion")
+	fmt.Println("  -seed-from-image Derive the seed for random motion and shuffle from the input images")
+	fmt.Println("  -rotate <deg>    Rotate the source clockwise by 90, 180 or 270 degrees before morphing")
+	fmt.Println("  -flip <h|v>      Flip the source horizontally or vertically (after -rotate)")
+	fmt.Println("  -invert <which>  Invert the colors of the source (src), the target (tgt) or both before planning")
+	fmt.Println("  -blur <sigma>    With the same file as source and target, morph to its Gaussian blur")
+	fmt.Println("  -crop-to-content Crop source and target to where both have content, dropping uniform borders")
+	fmt.Println("  -crop-tolerance <n> Per-channel difference from the corner color still treated as border (default: 16)")
+	fmt.Println("  -spool           Keep converted GIF frames in a temporary directory instead of memory, for very large GIFs")
+	fmt.Println("  -gifbg <color>   GIF background color (#rrggbb), added to the palette and written as the background index")
+	fmt.Println("  -transparent     Keep GIF cells that no pixel covers transparent instead of black")
+	fmt.Println("  -debug-bg checker  Fill intermediate GIF frames with a magenta/black checkerboard to reveal gaps")
+	fmt.Println("  -fontsize <px>   text: glyph height in pixels (default: 28)")
+	fmt.Println("  -canvas <WxH>    text: canvas size (default: fit the longer text with a margin)")
+	fmt.Println("  -fg/-bg <color>  text: text and background colors (default: #fff on #000)")
+	fmt.Println("  -fps <n>         video: frame rate (default: 30)")
+	fmt.Println("  -audio <file>    video: audio track muxed in, trimmed or looped to the video length")
+	fmt.Println("  -outtpl <tpl>    Build the output path from a template instead of the output argument,")
+	fmt.Println("                   e.g. '{{.name}}_{{.algorithm}}.gif' (fields: name, algorithm, index)")
+	fmt.Println("  -debug-gray <f>  Write the per-pixel grayscale values (source | target) to PNG file f")
+	fmt.Println("  -keep-exif       Copy the source EXIF data into a JPEG output (image command, JPEG source)")
+	fmt.Println("  -recolor <file>  Snap the final image to the nearest colors listed in file, one #rrggbb per line (image command)")
+	fmt.Println("\nDefaults can be set in ./.img2video.yaml or ~/.img2video.yaml, or with IMG2VIDEO_<KEY> environment variables")
+	fmt.Println("(e.g. IMG2VIDEO_DELAY=3), which override the file; command-line arguments take precedence over both.")
 }
 
-func handleAnalyze() {
-	if len(os.Args) < 4 {
+func handleSelftest() {
+	log.SetOutput(io.Discard) // 自检时只输出每个用例的结果
+	failures := runSelftest(func(name string, err error) {
+		if err != nil {
+			fmt.Printf("FAIL  %s: %v\n", name, err)
+		} else {
+			fmt.Printf("ok    %s\n", name)
+		}
+	})
+	if failures > 0 {
+		fmt.Printf("\n%d check(s) failed.\n", failures)
+		exit(1)
+	}
+	fmt.Println("\nAll checks passed.")
+}
+
+// withTimeout 在 timeout 大于 0 时给 opts 设置一个 timeout 后到期的 Context，使 RenderFrames 超时后停止。
+// 返回的函数释放 Context 的资源，应在渲染结束后调用
+func withTimeout(opts *FrameOptions, timeout time.Duration) context.CancelFunc {
+	if timeout <= 0 {
+		return func() {}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	opts.Context = ctx
+	return cancel
+}
+
+// exitOnTimeout 在 err 是 -timeout 到期造成的时，删除写了一半的输出文件并以明确的信息退出；其他错误直接返回，由调用方处理
+func exitOnTimeout(err error, timeout time.Duration, outputPath string) {
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	if outputPath != "-" {
+		os.Remove(outputPath)
+	}
+	fatalf("Error: the render did not finish within -timeout %s and was aborted (%v).", timeout, err)
+}
+
+// analyzeResult 是 analyze -json 输出的结果
+type analyzeResult struct {
+	SourceSum    float64 `json:"sourceSum"`
+	ReorderedSum float64 `json:"reorderedSum"`
+	Difference   float64 `json:"difference"`
+	Identical    bool    `json:"identical"`
+	SourceColors int     `json:"sourceColors"`
+	TargetColors int     `json:"targetColors"`
+}
+
+func handleAnalyze(cfg Config) {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	maxPixels := fs.Int("maxpixels", cfg.MaxPixels, "maximum number of pixels per input image (0 disables the limit)")
+	debugGray := fs.String("debug-gray", "", "write the computed grayscale values of source and target side by side to this PNG")
+	rotate := fs.Int("rotate", 0, "rotate the source clockwise by 90, 180 or 270 degrees")
+	flip := fs.String("flip", "", "flip the source horizontally (h) or vertically (v), after rotating")
+	invert := fs.String("invert", "", "invert the colors of the source (src), the target (tgt) or both before planning")
+	paletteName := fs.String("palette", cfg.Palette, "GIF palette used to measure quantization error: plan9, websafe, gray, adaptive or source")
+	seed := fs.Int64("seed", 1, "random seed for the shuffle algorithm")
+	threshMin := fs.Float64("threshmin", defaultThresholdMin, "lowest grayscale sorted by the threshold algorithm")
+	threshMax := fs.Float64("threshmax", defaultThresholdMax, "highest grayscale sorted by the threshold algorithm")
+	sortDesc := fs.Bool("sortdesc", false, "sort pixels from bright to dark instead of dark to bright")
+	ditherName := fs.String("dither", "none", "dithering used to measure quantization error: none, floyd or serpentine")
+	jsonOut := fs.Bool("json", false, "print the grayscale sum comparison as JSON instead of the human-readable report")
+	distanceName := fs.String("distance", "euclidean", "metric for the travel distance report: euclidean, manhattan or chebyshev")
+	compareAll := fs.Bool("compare-all", false, "compare frames, travel and estimated GIF size of every algorithm in a table instead")
+	fs.Parse(os.Args[2:])
+	planOpts := PlanOptions{Seed: *seed, ThresholdMin: *threshMin, ThresholdMax: *threshMax, Descending: *sortDesc}
+	if err := checkPlanOptions(planOpts); err != nil {
+		fatalf("Error: %v", err)
+	}
+	args := fs.Args()
+
+	if len(args) < 2 {
 		printUsage()
-		os.Exit(1)
+		exit(1)
 	}
-	sourcePath := os.Args[2]
-	targetPath := os.Args[3]
-	algorithm := "default"
-	if len(os.Args) > 4 {
-		algorithm = os.Args[4]
+	sourcePath := args[0]
+	targetPath := args[1]
+	algorithm := cfg.Algorithm
+	if len(args) > 2 {
+		algorithm = args[2]
+	}
+
+	gifPalette, err := paletteByName(*paletteName)
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+	dither, err := ditherByName(*ditherName)
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+	dist, err := distanceByName(*distanceName)
+	if err != nil {
+		fatalf("Error: %v", err)
 	}
 
 	log.Printf("Loading source image: %s", sourcePath)
-	sourceImg, err := readImage(sourcePath)
+	sourceImg, err := readImage(sourcePath, *maxPixels)
 	if err != nil {
-		log.Fatalf("Failed to read source image: %v", err)
+		fatalf("Failed to read source image: %v", err)
+	}
+	if strings.EqualFold(*paletteName, "source") {
+		if gifPalette, err = sourcePalette(sourceImg); err != nil {
+			fatalf("Error: %v", err)
+		}
+	}
+	sourceImg, err = Transform{Rotate: *rotate, Flip: *flip}.Apply(sourceImg)
+	if err != nil {
+		fatalf("Failed to transform source image: %v", err)
 	}
 
 	log.Printf("Loading target image: %s", targetPath)
-	targetImg, err := readImage(targetPath)
+	targetImg, err := readImage(targetPath, *maxPixels)
 	if err != nil {
-		log.Fatalf("Failed to read target image: %v", err)
+		fatalf("Failed to read target image: %v", err)
+	}
+	if sourceImg, targetImg, err = applyInvert(*invert, sourceImg, targetImg); err != nil {
+		fatalf("Error: %v", err)
+	}
+
+	if *debugGray != "" {
+		if err := SaveGrayscaleDebug(sourceImg, targetImg, *debugGray); err != nil {
+			fatalf("Error saving grayscale debug image: %v", err)
+		}
+	}
+
+	if *compareAll {
+		if err := checkDimensions(sourceImg, targetImg); err != nil {
+			fatalf("Error: %v", err)
+		}
+		// 估计大小时固定随机运动的种子，使每次比较的结果相同
+		gifOpts := GIFOptions{
+			FrameOptions: FrameOptions{FrameStep: cfg.FrameStep, Motion: cfg.Motion, Seed: 1},
+			Palette:      gifPalette,
+			Dither:       dither,
+		}
+		type row struct {
+			result    algorithmResult
+			total     float64
+			longest   float64
+			sizeBytes int64
+		}
+		results, err := compareAlgorithms(sourceImg, targetImg, planOpts)
+		if err != nil {
+			fatalf("Error: %v", err)
+		}
+		var rows []row
+		for _, r := range results {
+			log.Printf("Encoding a GIF with the %s algorithm to estimate its size...", r.Name)
+			size, err := encodedGIFSize(r.Plan, cfg.Delay, gifOpts)
+			if err != nil {
+				fatalf("Error encoding GIF: %v", err)
+			}
+			rows = append(rows, row{r, TotalDistance(r.Plan, dist), MaxDistance(r.Plan, dist), size})
+		}
+		fmt.Printf("\n--- Algorithm Comparison (%s travel) ---\n", *distanceName)
+		fmt.Printf("%-12s %8s %14s %10s %12s\n", "Algorithm", "Frames", "Total travel", "Max travel", "GIF bytes")
+		for _, r := range rows {
+			fmt.Printf("%-12s %8d %14.1f %10.1f %12d\n", r.result.Name, r.result.Plan.Frames, r.total, r.longest, r.sizeBytes)
+		}
+		return
 	}
 
 	// 1. 计算原图的灰度总和
@@ -84,31 +364,39 @@ func handleAnalyze() {
 	log.Printf("Source Image Grayscale Sum: %f", sourceSum)
 
 	// 2. 在内存中进行重排
-	log.Printf("Creating animation plan using '%s' algorithm...", algorithm)
-	var plan *AnimationPlan
-	switch algorithm {
-	case "default":
-		plan = CreateAnimationPlan(sourceImg, targetImg)
-	case "featured":
-		plan = CreateAnimationPlanFeatured(sourceImg, targetImg)
-	default:
-		log.Fatalf("Unknown algorithm: %s", algorithm)
+	plan, err := createPlan(algorithm, sourceImg, targetImg, planOpts)
+	if err != nil {
+		fatalf("Error: %v", err)
 	}
 
-	// 3. 在内存中创建重排后的图像
-	reorderedImg := image.NewRGBA(plan.Bounds)
-	for _, p := range plan.Pixels {
-		reorderedImg.Set(p.TargetX, p.TargetY, p.Color)
+	// 3. 直接从计划中的像素计算重排结果的灰度总和，无需生成图像
+	reorderedSum := PlanGrayscaleSum(plan)
+	log.Printf("In-Memory Reordered Image Grayscale Sum: %f", reorderedSum)
+
+	// 使用一个小的容差来比较浮点数，以客户浮点数精度问题
+	identical := math.Abs(sourceSum-reorderedSum) < 0.0001
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(analyzeResult{
+			SourceSum:    sourceSum,
+			ReorderedSum: reorderedSum,
+			Difference:   reorderedSum - sourceSum,
+			Identical:    identical,
+			SourceColors: UniqueColors(sourceImg),
+			TargetColors: UniqueColors(targetImg),
+		}); err != nil {
+			fatalf("Error writing JSON: %v", err)
+		}
+		return
 	}
 
-	// 4. 计算内存中重排图像的灰度总和
-	reorderedSum := CalculateGrayscaleSum(reorderedImg)
-	log.Printf("In-Memory Reordered Image Grayscale Sum: %f", reorderedSum)
+	// 4. 在内存中创建重排后的图像，仅用于下面的量化比较
+	reorderedImg := renderTarget(plan)
 
 	// 5. 打印分析结果
 	fmt.Println("\n--- Analysis Result ---")
-	// 使用一个小的容差来比较浮点数，以客户浮点数精度问题
-	if math.Abs(sourceSum-reorderedSum) < 0.0001 {
+	if identical {
 		fmt.Println("SUCCESS: The grayscale sum is effectively IDENTICAL before and after reordering in memory.")
 		fmt.Printf("(Difference: %f, which is within the tolerance for floating-point arithmetic)\n", reorderedSum-sourceSum)
 		fmt.Println("This proves the core algorithm correctly preserves all pixel data.")
@@ -120,26 +408,502 @@ func handleAnalyze() {
 		fmt.Println("ERROR: The grayscale sum is DIFFERENT. This indicates a potential bug in the reordering logic.")
 		fmt.Printf("Difference: %f\n", reorderedSum-sourceSum)
 	}
+
+	// 6. 像 SaveGIF 一样对重排图像进行调色板量化，测量量化带来的误差
+	if gifPalette == nil {
+		gifPalette = buildGlobalPalette([]*image.RGBA{reorderedImg})
+	}
+	quantized := quantize(reorderedImg, gifPalette, dither)
+	fmt.Printf("\n--- GIF Quantization (%s palette, %s dithering) ---\n", *paletteName, *ditherName)
+	// 重排结果与源图像由同一组像素组成，颜色数相同
+	sourceColors := UniqueColors(sourceImg)
+	fmt.Printf("Unique colors: source %d, target %d", sourceColors, UniqueColors(targetImg))
+	if sourceColors <= 256 {
+		fmt.Printf(" (the animation fits a %d-color palette exactly)\n", sourceColors)
+	} else {
+		fmt.Println(" (the animation needs more than 256 colors)")
+	}
+	fmt.Printf("RMSE introduced by quantization: %.3f (0-255 scale)\n", RMSE(reorderedImg, quantized))
+	quantizedSum := CalculateGrayscaleSum(quantized)
+	fmt.Printf("Grayscale sum after quantization: %f (difference: %f)\n", quantizedSum, quantizedSum-reorderedSum)
+
+	// 7. 按所选的距离度量统计像素移动的总距离
+	total := TotalDistance(plan, dist)
+	fmt.Printf("\n--- Travel Distance (%s) ---\n", *distanceName)
+	fmt.Printf("Total: %.1f, mean per pixel: %.3f\n", total, total/float64(max(1, len(plan.Pixels))))
+
+	// 8. 比较普通计划和紧凑计划的内存占用
+	compact := plan.Compact()
+	fmt.Println("\n--- Plan Memory ---")
+	fmt.Printf("Pixels: %d bytes; compact: %d runs, %d bytes (%.1f%%)\n",
+		planSizeBytes(plan), len(compact.Runs), compact.SizeBytes(), float64(compact.SizeBytes())*100/float64(max(1, planSizeBytes(plan))))
+
+	// 9. 统计像素轨迹的交叉数，数值越小动画看起来越有序
+	crossings, exact := countCrossings(plan)
+	fmt.Println("\n--- Trajectory Crossings ---")
+	if exact {
+		fmt.Printf("Crossing trajectory pairs: %d\n", crossings)
+	} else {
+		fmt.Printf("Crossing trajectory pairs: ~%d (estimated from %d sampled trajectories)\n", crossings, crossingsSampleSize)
+	}
 }
 
-func handleGenerate(command string) {
-	if len(os.Args) < 5 {
+func handleCompareAlgos(cfg Config) {
+	fs := flag.NewFlagSet("compare-algos", flag.ExitOnError)
+	maxPixels := fs.Int("maxpixels", cfg.MaxPixels, "maximum number of pixels per input image (0 disables the limit)")
+	seed := fs.Int64("seed", 1, "random seed for the shuffle algorithm")
+	threshMin := fs.Float64("threshmin", defaultThresholdMin, "lowest grayscale sorted by the threshold algorithm")
+	threshMax := fs.Float64("threshmax", defaultThresholdMax, "highest grayscale sorted by the threshold algorithm")
+	sortDesc := fs.Bool("sortdesc", false, "sort pixels from bright to dark instead of dark to bright")
+	fs.Parse(os.Args[2:])
+	planOpts := PlanOptions{Seed: *seed, ThresholdMin: *threshMin, ThresholdMax: *threshMax, Descending: *sortDesc}
+	if err := checkPlanOptions(planOpts); err != nil {
+		fatalf("Error: %v", err)
+	}
+	args := fs.Args()
+
+	if len(args) < 3 {
+		printUsage()
+		exit(1)
+	}
+	sourcePath, targetPath, outputPath := args[0], args[1], args[2]
+
+	log.Printf("Reading source image: %s", sourcePath)
+	sourceImg, err := readImage(sourcePath, *maxPixels)
+	if err != nil {
+		fatalf("Error reading source image: %v", err)
+	}
+	log.Printf("Reading target image: %s", targetPath)
+	targetImg, err := readImage(targetPath, *maxPixels)
+	if err != nil {
+		fatalf("Error reading target image: %v", err)
+	}
+	if err := checkDimensions(sourceImg, targetImg); err != nil {
+		fatalf("Error: %v", err)
+	}
+
+	results, err := compareAlgorithms(sourceImg, targetImg, planOpts)
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+	if err := SaveAlgorithmComparison(sourceImg, targetImg, results, outputPath); err != nil {
+		fatalf("Error saving comparison: %v", err)
+	}
+
+	fmt.Printf("%-12s %8s %14s\n", "Algorithm", "Frames", "Mean distance")
+	for _, r := range results {
+		fmt.Printf("%-12s %8d %14.3f\n", r.Name, r.Plan.Frames, r.MeanDistance)
+	}
+	log.Printf("Comparison saved successfully to: %s", outputPath)
+}
+
+func handleGrayHist(cfg Config) {
+	fs := flag.NewFlagSet("grayhist", flag.ExitOnError)
+	maxPixels := fs.Int("maxpixels", cfg.MaxPixels, "maximum number of pixels per input image (0 disables the limit)")
+	buckets := fs.Int("buckets", 16, "number of equal-width grayscale buckets (1-256)")
+	fs.Parse(os.Args[2:])
+	args := fs.Args()
+
+	if len(args) < 3 {
+		printUsage()
+		exit(1)
+	}
+	sourcePath, targetPath, outputPath := args[0], args[1], args[2]
+
+	log.Printf("Reading source image: %s", sourcePath)
+	sourceImg, err := readImage(sourcePath, *maxPixels)
+	if err != nil {
+		fatalf("Error reading source image: %v", err)
+	}
+	log.Printf("Reading target image: %s", targetPath)
+	targetImg, err := readImage(targetPath, *maxPixels)
+	if err != nil {
+		fatalf("Error reading target image: %v", err)
+	}
+
+	if err := SaveGrayHistogram(sourceImg, targetImg, *buckets, outputPath); err != nil {
+		fatalf("Error saving grayscale histogram: %v", err)
+	}
+	log.Printf("Grayscale histogram saved successfully to: %s", outputPath)
+}
+
+func handleSortStrip(cfg Config) {
+	fs := flag.NewFlagSet("sortstrip", flag.ExitOnError)
+	maxPixels := fs.Int("maxpixels", cfg.MaxPixels, "maximum number of pixels in the input image (0 disables the limit)")
+	width := fs.Int("width", 0, "wrap the strip into rows of this many pixels (0 keeps a single row)")
+	fs.Parse(os.Args[2:])
+	args := fs.Args()
+
+	if len(args) < 2 {
+		printUsage()
+		exit(1)
+	}
+	imagePath, outputPath := args[0], args[1]
+	algorithm := cfg.Algorithm
+	if len(args) > 2 {
+		algorithm = args[2]
+	}
+
+	log.Printf("Reading image: %s", imagePath)
+	img, err := readImage(imagePath, *maxPixels)
+	if err != nil {
+		fatalf("Error reading image: %v", err)
+	}
+	if err := SaveSortStrip(img, algorithm, *width, outputPath); err != nil {
+		fatalf("Error saving sort strip: %v", err)
+	}
+	log.Printf("Sort strip saved successfully to: %s", outputPath)
+}
+
+// handleDiffPlan 比较 -saveplan 保存的两个计划，报告有多少像素的终点不同以及终点移动距离的分布
+func handleDiffPlan() {
+	if len(os.Args) < 4 {
 		printUsage()
-		os.Exit(1)
+		exit(1)
 	}
-	sourceImagePath := os.Args[2]
-	targetImagePath := os.Args[3]
-	outputPath := os.Args[4]
+	a, err := LoadPlanJSON(os.Args[2])
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+	b, err := LoadPlanJSON(os.Args[3])
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+	diff, err := diffPlans(a, b)
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+	writePlanDiff(os.Stdout, diff)
+}
 
-	algorithm := "default"
-	frameDelay := 1
+func handleDissolve(cfg Config) {
+	fs := flag.NewFlagSet("dissolve", flag.ExitOnError)
+	paletteName := fs.String("palette", cfg.Palette, "GIF palette: plan9, websafe, gray or adaptive")
+	ditherName := fs.String("dither", "none", "GIF dithering: none, floyd or serpentine")
+	delay := fs.Int("delay", cfg.Delay, "frame delay in 1/100 s")
+	boomerang := fs.Bool("boomerang", false, "play the GIF forward and then backward")
+	maxPixels := fs.Int("maxpixels", cfg.MaxPixels, "maximum number of pixels per input image (0 disables the limit)")
+	fs.Parse(os.Args[2:])
+	args := fs.Args()
 
-	if len(os.Args) > 5 {
-		val, err := strconv.Atoi(os.Args[5])
+	if len(args) < 3 {
+		printUsage()
+		exit(1)
+	}
+	sourcePath, targetPath, outputPath := args[0], args[1], args[2]
+	frames := 10
+	if len(args) > 3 {
+		n, err := strconv.Atoi(args[3])
 		if err != nil {
-			algorithm = strings.ToLower(os.Args[5])
-			if len(os.Args) > 6 {
-				delay, err := strconv.Atoi(os.Args[6])
+			fatalf("Error: invalid frame count %q.", args[3])
+		}
+		frames = n
+	}
+
+	if strings.EqualFold(*paletteName, "source") {
+		fatalf("Error: -palette source is not supported by dissolve, whose blended colors are not in the source palette.")
+	}
+	gifPalette, err := paletteByName(*paletteName)
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+	dither, err := ditherByName(*ditherName)
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+
+	log.Printf("Reading source image: %s", sourcePath)
+	sourceImg, err := readImage(sourcePath, *maxPixels)
+	if err != nil {
+		fatalf("Error reading source image: %v", err)
+	}
+	log.Printf("Reading target image: %s", targetPath)
+	targetImg, err := readImage(targetPath, *maxPixels)
+	if err != nil {
+		fatalf("Error reading target image: %v", err)
+	}
+
+	_, err = SaveDissolve(sourceImg, targetImg, frames, outputPath, *delay, GIFOptions{
+		Palette:         gifPalette,
+		AdaptivePalette: strings.EqualFold(*paletteName, "adaptive"),
+		Dither:          dither,
+		Boomerang:       *boomerang,
+	})
+	if err != nil {
+		fatalf("Error saving dissolve GIF: %v", err)
+	}
+	log.Printf("Dissolve GIF saved successfully to: %s", outputPath)
+}
+
+func handleSnake(cfg Config) {
+	fs := flag.NewFlagSet("snake", flag.ExitOnError)
+	curve := fs.String("curve", "hilbert", "space-filling curve the image is drawn along: hilbert or boustrophedon")
+	paletteName := fs.String("palette", cfg.Palette, "GIF palette: plan9, websafe, gray, adaptive or source")
+	ditherName := fs.String("dither", "none", "GIF dithering: none, floyd or serpentine")
+	delay := fs.Int("delay", cfg.Delay, "frame delay in 1/100 s")
+	transparent := fs.Bool("transparent", false, "keep the part of the image not drawn yet transparent in the GIF")
+	boomerang := fs.Bool("boomerang", false, "play the GIF forward and then backward")
+	maxPixels := fs.Int("maxpixels", cfg.MaxPixels, "maximum number of pixels per input image (0 disables the limit)")
+	fs.Parse(os.Args[2:])
+	args := fs.Args()
+
+	if len(args) < 2 {
+		printUsage()
+		exit(1)
+	}
+	targetPath, outputPath := args[0], args[1]
+	frames := 40
+	if len(args) > 2 {
+		n, err := strconv.Atoi(args[2])
+		if err != nil {
+			fatalf("Error: invalid frame count %q.", args[2])
+		}
+		frames = n
+	}
+
+	gifPalette, err := paletteByName(*paletteName)
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+	dither, err := ditherByName(*ditherName)
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+
+	log.Printf("Reading target image: %s", targetPath)
+	targetImg, err := readImage(targetPath, *maxPixels)
+	if err != nil {
+		fatalf("Error reading target image: %v", err)
+	}
+	if strings.EqualFold(*paletteName, "source") {
+		// snake 只画出目标图像本身的颜色，直接使用它的调色板
+		if gifPalette, err = sourcePalette(targetImg); err != nil {
+			fatalf("Error: %v", err)
+		}
+	}
+
+	_, err = SaveSnake(targetImg, *curve, frames, outputPath, *delay, GIFOptions{
+		Palette:         gifPalette,
+		AdaptivePalette: strings.EqualFold(*paletteName, "adaptive"),
+		ExactPalette:    exactPaletteFor(*paletteName),
+		Dither:          dither,
+		Boomerang:       *boomerang,
+		Transparent:     *transparent,
+	})
+	if err != nil {
+		fatalf("Error saving snake GIF: %v", err)
+	}
+	log.Printf("Snake GIF saved successfully to: %s", outputPath)
+}
+
+func handleChain(cfg Config) {
+	fs := flag.NewFlagSet("chain", flag.ExitOnError)
+	algorithm := fs.String("algorithm", cfg.Algorithm, "algorithm used for every segment")
+	paletteName := fs.String("palette", cfg.Palette, "GIF palette: plan9, websafe, gray, adaptive or source")
+	maxPixels := fs.Int("maxpixels", cfg.MaxPixels, "maximum number of pixels per input image (0 disables the limit)")
+	frameStep := fs.Int("framestep", cfg.FrameStep, "number of movement steps per emitted GIF frame")
+	motion := fs.String("motion", cfg.Motion, "pixel motion: random, dither, deterministic, line, gravity or wave")
+	delayList := fs.String("delays", "", "comma-separated frame delay of each segment in 1/100 s (default: the configured delay)")
+	maxStep := fs.Int("maxstep", 0, "cap the per-frame step of the random and dither motions, for smoother motion on large images (0 disables)")
+	waveWidth := fs.Float64("wavewidth", defaultWaveWidth, "fraction of the animation each pixel spends moving in the wave motion (0-1)")
+	jitter := fs.Float64("jitter", 0, "randomly offset moving pixels up to this many pixels perpendicular to their path (0 disables)")
+	holdList := fs.String("holds", "", "comma-separated extra time to hold each segment's final image in 1/100 s (default: 0)")
+	loopDelay := fs.Int("loopdelay", 0, "delay of the last frame in 1/100 s before the GIF loops; the last -holds value is added on top (0 keeps the frame delay)")
+	seed := fs.Int64("seed", 1, "random seed for the shuffle algorithm")
+	threshMin := fs.Float64("threshmin", defaultThresholdMin, "lowest grayscale sorted by the threshold algorithm")
+	threshMax := fs.Float64("threshmax", defaultThresholdMax, "highest grayscale sorted by the threshold algorithm")
+	sortDesc := fs.Bool("sortdesc", false, "sort pixels from bright to dark instead of dark to bright")
+	fs.Parse(os.Args[2:])
+	planOpts := PlanOptions{Seed: *seed, ThresholdMin: *threshMin, ThresholdMax: *threshMax, Descending: *sortDesc}
+	if err := checkPlanOptions(planOpts); err != nil {
+		fatalf("Error: %v", err)
+	}
+	args := fs.Args()
+
+	if len(args) < 3 {
+		printUsage()
+		exit(1)
+	}
+	outputPath, imagePaths := args[0], args[1:]
+	segments := len(imagePaths) - 1
+
+	delays, err := parseIntList(*delayList)
+	if err != nil {
+		fatalf("Error: -delays: %v", err)
+	}
+	if delays == nil {
+		delays = slices.Repeat([]int{cfg.Delay}, segments)
+	}
+	holds, err := parseIntList(*holdList)
+	if err != nil {
+		fatalf("Error: -holds: %v", err)
+	}
+	if holds == nil {
+		holds = make([]int, segments)
+	}
+	if len(delays) != segments || len(holds) != segments {
+		fatalf("Error: -delays and -holds need one value per segment (%d for %d images).", segments, len(imagePaths))
+	}
+	if *loopDelay < 0 {
+		fatalf("Error: -loopdelay must not be negative.")
+	}
+	gifPalette, err := paletteByName(*paletteName)
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+
+	var images []image.Image
+	for _, path := range imagePaths {
+		log.Printf("Reading image: %s", path)
+		img, err := readImage(path, *maxPixels)
+		if err != nil {
+			fatalf("Error reading image: %v", err)
+		}
+		images = append(images, img)
+	}
+	if strings.EqualFold(*paletteName, "source") {
+		if gifPalette, err = sourcePalette(images[0]); err != nil {
+			fatalf("Error: %v", err)
+		}
+	}
+
+	err = SaveChainedGIF(images, *algorithm, outputPath, planOpts, delays, holds, GIFOptions{
+		FrameOptions:    FrameOptions{FrameStep: *frameStep, Motion: *motion, MaxStep: *maxStep, WaveWidth: *waveWidth, Jitter: *jitter},
+		Palette:         gifPalette,
+		AdaptivePalette: strings.EqualFold(*paletteName, "adaptive"),
+		ExactPalette:    exactPaletteFor(*paletteName),
+		LoopDelay:       *loopDelay,
+	})
+	if err != nil {
+		fatalf("Error saving chained GIF: %v", err)
+	}
+	log.Printf("Chained GIF saved successfully to: %s", outputPath)
+}
+
+// textImages 按 text 命令的选项把两段文字绘制为尺寸相同的源图像和目标图像
+func textImages(from, to string, fontSize int, canvas, fg, bg string) (image.Image, image.Image, error) {
+	size, err := parseOutputSize(canvas, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	fgc, err := parseHexColor(fg)
+	if err != nil {
+		return nil, nil, err
+	}
+	bgc, err := parseHexColor(bg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fontSize < 1 {
+		return nil, nil, fmt.Errorf("-fontsize must be at least 1")
+	}
+	bounds := textCanvas([]string{from, to}, fontSize, size)
+	log.Printf("Rendering %q and %q on a %dx%d canvas...", from, to, bounds.Dx(), bounds.Dy())
+	source, err := renderText(from, bounds, fontSize, fgc, bgc)
+	if err != nil {
+		return nil, nil, err
+	}
+	target, err := renderText(to, bounds, fontSize, fgc, bgc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return source, target, nil
+}
+
+func handleGenerate(command string, cfg Config) {
+	start := time.Now()
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	paletteName := fs.String("palette", cfg.Palette, "GIF palette: plan9, websafe, gray, adaptive or source")
+	paletteFrom := fs.String("palette-from", "", "build the GIF palette by median cut from this style image instead (overrides -palette)")
+	ditherName := fs.String("dither", "none", "GIF dithering: none, floyd or serpentine")
+	outSize := fs.String("outsize", "", "scale the emitted GIF frames or output image to WxH after morphing at native resolution")
+	fit := fs.Bool("fit", false, "with -outsize, keep the aspect ratio and fit inside WxH")
+	debugBG := fs.String("debug-bg", "", "fill intermediate frames with a background before plotting pixels: checker")
+	flash := fs.Bool("flash", false, "flash pixels white when they arrive and fade them back to their color over a few frames")
+	noSource := fs.Bool("no-first-frame-source", false, "start the GIF already in motion instead of with the reconstructed source frame")
+	trim := fs.Bool("trim", false, "merge runs of identical consecutive GIF frames into one frame with the summed delay")
+	loopDelay := fs.Int("loopdelay", 0, "delay of the last GIF frame in 1/100 s, so the final image lingers before the loop restarts (0 keeps the frame delay)")
+	lossy := fs.Int("lossy", 0, "drop this many low bits (0-7) of each color channel before quantizing, for smaller GIFs")
+	maxPixels := fs.Int("maxpixels", cfg.MaxPixels, "maximum number of pixels per input image (0 disables the limit)")
+	frameStep := fs.Int("framestep", cfg.FrameStep, "number of movement steps per emitted GIF frame")
+	timeout := fs.Duration("timeout", 0, "abort the render if it takes longer than this, e.g. 30s (0 disables)")
+	stats := fs.Bool("stats", false, "also write render statistics as JSON to <output>.stats.json")
+	explain := fs.Bool("explain", false, "print a summary of the animation to stderr before rendering (gif, fade and text)")
+	savePlan := fs.String("saveplan", "", "also write the animation plan as JSON to this file, for the diffplan command")
+	timestamps := fs.String("timestamps", "", "also write per-frame timestamps (mkvmerge v2 format) for the GIF to this file")
+	duration := fs.Duration("duration", 0, "choose the frame delay so the GIF lasts about this long, e.g. 3s (overrides the delay argument)")
+	maxFrames := fs.Int("maxframes", 0, "speed up or skip frames so the GIF has at most this many frames (0 disables)")
+	capStrategy := fs.String("cap-strategy", "speed", "how -maxframes is enforced: speed (faster motion) or skip (sample the full-speed animation)")
+	motion := fs.String("motion", cfg.Motion, "pixel motion: random, dither, deterministic, line, gravity or wave")
+	maxStep := fs.Int("maxstep", 0, "cap the per-frame step of the random and dither motions, for smoother motion on large images (0 disables)")
+	waveWidth := fs.Float64("wavewidth", defaultWaveWidth, "fraction of the animation each pixel spends moving in the wave motion (0-1)")
+	jitter := fs.Float64("jitter", 0, "randomly offset moving pixels up to this many pixels perpendicular to their path (0 disables)")
+	boomerang := fs.Bool("boomerang", false, "play the GIF forward and then backward")
+	invertReturn := fs.Bool("invert-return", false, "invert the colors of the backward leg (requires -boomerang)")
+	transparent := fs.Bool("transparent", false, "keep cells that no pixel covers transparent in the GIF")
+	spool := fs.Bool("spool", false, "spool converted GIF frames to a temporary directory instead of keeping them all in memory")
+	gifBG := fs.String("gifbg", "", "GIF background color (#rgb or #rrggbb), added to the palette and used as the background index")
+	debugGray := fs.String("debug-gray", "", "write the computed grayscale values of source and target side by side to this PNG")
+	keepExif := fs.Bool("keep-exif", false, "copy the source EXIF block into a JPEG output (image command, JPEG source only)")
+	recolor := fs.String("recolor", "", "snap every pixel of the final image to the nearest color listed in this file, one #rrggbb per line (image command)")
+	blockSize := fs.Int("blocksize", 1, "move NxN pixel blocks as units instead of single pixels")
+	rotate := fs.Int("rotate", 0, "rotate the source clockwise by 90, 180 or 270 degrees")
+	flip := fs.String("flip", "", "flip the source horizontally (h) or vertically (v), after rotating")
+	invert := fs.String("invert", "", "invert the colors of the source (src), the target (tgt) or both before planning")
+	blurSigma := fs.Float64("blur", 0, "when source and target are the same file, morph to a Gaussian blur of it with this sigma")
+	cropContent := fs.Bool("crop-to-content", false, "crop source and target to where both have content, dropping uniform or transparent borders")
+	cropTolerance := fs.Int("crop-tolerance", 16, "largest per-channel difference from the corner color still treated as border by -crop-to-content (0-255)")
+	maskPath := fs.String("mask", "", "black/white mask image: only pixels under white areas move, black areas stay fixed")
+	changedOnly := fs.Bool("changed-only", false, "only pixels whose color differs between source and target move; identical pixels stay fixed")
+	anchors := fs.String("anchors", "", "pixel positions pinned in place, as x1,y1;x2,y2;...")
+	alphaThreshold := fs.Int("alphathreshold", 0, "only source pixels with alpha >= this value (0-255) move; the rest stay fixed")
+	seed := fs.Int64("seed", 1, "random seed for the shuffle algorithm")
+	threshMin := fs.Float64("threshmin", defaultThresholdMin, "lowest grayscale sorted by the threshold algorithm")
+	threshMax := fs.Float64("threshmax", defaultThresholdMax, "highest grayscale sorted by the threshold algorithm")
+	sortDesc := fs.Bool("sortdesc", false, "sort pixels from bright to dark instead of dark to bright")
+	seedFromImage := fs.Bool("seed-from-image", false, "derive the random seed for the random motion and the shuffle algorithm from the input images")
+	fontSize := fs.Int("fontsize", 28, "text command: glyph height in pixels")
+	canvas := fs.String("canvas", "", "text command: canvas size WxH (default: fit the longer text with a margin)")
+	fgColor := fs.String("fg", "#fff", "text command: text color")
+	bgColor := fs.String("bg", "#000", "text command: background color")
+	outTpl := fs.String("outtpl", "", "output file name template, e.g. {{.name}}_{{.algorithm}}.gif; replaces the output argument")
+	fs.Parse(os.Args[2:])
+	planOpts := PlanOptions{Seed: *seed, ThresholdMin: *threshMin, ThresholdMax: *threshMax, Descending: *sortDesc}
+	if err := checkPlanOptions(planOpts); err != nil {
+		fatalf("Error: %v", err)
+	}
+	args := fs.Args()
+
+	// 使用 -outtpl 时省略了输出文件参数，插入一个占位符使后面的位置参数保持不变
+	var outputTemplate *template.Template
+	if *outTpl != "" {
+		tpl, err := parseOutputTemplate(*outTpl)
+		if err != nil {
+			fatalf("Error: %v", err)
+		}
+		outputTemplate = tpl
+		if len(args) >= 2 {
+			args = append(args[:2], append([]string{""}, args[2:]...)...)
+		}
+	}
+
+	if len(args) < 3 {
+		printUsage()
+		exit(1)
+	}
+	sourceImagePath := args[0]
+	targetImagePath := args[1]
+	outputPath := args[2]
+
+	algorithm := cfg.Algorithm
+	frameDelay := cfg.Delay
+
+	if len(args) > 3 {
+		val, err := strconv.Atoi(args[3])
+		if err != nil {
+			algorithm = strings.ToLower(args[3])
+			if len(args) > 4 {
+				delay, err := strconv.Atoi(args[4])
 				if err == nil {
 					frameDelay = delay
 				}
@@ -148,56 +912,412 @@ func handleGenerate(command string) {
 			frameDelay = val
 		}
 	}
-	if len(os.Args) > 6 {
-		if _, err := strconv.Atoi(os.Args[5]); err != nil {
-			delay, err := strconv.Atoi(os.Args[6])
+	if len(args) > 4 {
+		if _, err := strconv.Atoi(args[3]); err != nil {
+			delay, err := strconv.Atoi(args[4])
 			if err == nil {
 				frameDelay = delay
 			}
 		}
 	}
 
-	log.Printf("Reading source image: %s", sourceImagePath)
-	sourceImg, err := readImage(sourceImagePath)
+	// fade 命令的第二个参数是颜色而不是图片路径
+	var fadeColor color.RGBA
+	if command == "fade" {
+		c, err := parseHexColor(targetImagePath)
+		if err != nil {
+			fatalf("Error: %v", err)
+		}
+		fadeColor = c
+	}
+
+	if outputTemplate != nil {
+		path, err := executeOutputTemplate(outputTemplate, outputFields{Name: baseName(sourceImagePath), Algorithm: algorithm})
+		if err != nil {
+			fatalf("Error: %v", err)
+		}
+		outputPath = path
+		log.Printf("Output path from template: %s", outputPath)
+	}
+
+	gifPalette, err := paletteByName(*paletteName)
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+	dither, err := ditherByName(*ditherName)
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+	if *invertReturn && !*boomerang {
+		fatalf("Error: -invert-return requires -boomerang.")
+	}
+	if *debugBG != "" && *debugBG != "checker" {
+		fatalf("Error: unknown -debug-bg %q. Please use 'checker'.", *debugBG)
+	}
+	outputSize, err := parseOutputSize(*outSize, *fit)
 	if err != nil {
-		log.Fatalf("Error reading source image: %v", err)
+		fatalf("Error: %v", err)
+	}
+	if *lossy < 0 || *lossy > 7 {
+		fatalf("Error: -lossy must be between 0 and 7.")
+	}
+	animated := command == "gif" || command == "fade" || command == "text"
+	if *duration != 0 && (!animated || *duration < 20*time.Millisecond) {
+		fatalf("Error: -duration only applies to the gif, fade and text commands and must be at least 20ms.")
+	}
+	if *loopDelay != 0 && (!animated || *loopDelay < 0) {
+		fatalf("Error: -loopdelay only applies to the gif, fade and text commands and must not be negative.")
+	}
+	if *maxFrames != 0 && (!animated || *maxFrames < 2) {
+		fatalf("Error: -maxframes only applies to the gif, fade and text commands and must be at least 2.")
+	}
+	if *timeout != 0 && (!animated || *timeout < 0) {
+		fatalf("Error: -timeout only applies to the gif, fade and text commands and must not be negative.")
+	}
+	if *stats && !animated {
+		fatalf("Error: -stats only applies to the gif, fade and text commands.")
+	}
+	if *explain && !animated {
+		fatalf("Error: -explain only applies to the gif, fade and text commands.")
+	}
+	if *spool && (!animated || *boomerang || *trim) {
+		fatalf("Error: -spool only applies to the gif, fade and text commands and cannot be combined with -boomerang or -trim.")
+	}
+	var background *color.RGBA
+	if *gifBG != "" {
+		if !animated || *transparent {
+			fatalf("Error: -gifbg only applies to the gif, fade and text commands and cannot be combined with -transparent.")
+		}
+		c, err := parseHexColor(*gifBG)
+		if err != nil {
+			fatalf("Error: %v", err)
+		}
+		if c.A != 0xFF {
+			fatalf("Error: the -gifbg color must be opaque.")
+		}
+		background = &c
 	}
 
-	log.Printf("Reading target image: %s", targetImagePath)
-	targetImg, err := readImage(targetImagePath)
+	imageOpts := ImageOptions{OutSize: outputSize}
+	if *keepExif {
+		ext := strings.ToLower(filepath.Ext(outputPath))
+		if command != "image" || (ext != ".jpg" && ext != ".jpeg") {
+			fatalf("Error: -keep-exif only applies to the image command with a .jpg/.jpeg output.")
+		}
+		exif, err := readJPEGExif(sourceImagePath)
+		if err != nil {
+			fatalf("Error reading source EXIF: %v", err)
+		}
+		if exif == nil {
+			log.Printf("Warning: source image %s has no EXIF data to keep.", sourceImagePath)
+		}
+		imageOpts.EXIF = exif
+	}
+	if *recolor != "" {
+		if command != "image" {
+			fatalf("Error: -recolor only applies to the image command.")
+		}
+		colors, err := readColorList(*recolor)
+		if err != nil {
+			fatalf("Error reading color list: %v", err)
+		}
+		log.Printf("Recoloring the final image with %d colors from %s.", len(colors), *recolor)
+		imageOpts.Recolor = colors
+	}
+
+	// text 命令的前两个参数是要绘制的文字，其余命令是图片路径
+	var sourceImg, textTarget image.Image
+	if command == "text" {
+		sourceImg, textTarget, err = textImages(sourceImagePath, targetImagePath, *fontSize, *canvas, *fgColor, *bgColor)
+		if err != nil {
+			fatalf("Error: %v", err)
+		}
+	} else {
+		log.Printf("Reading source image: %s", sourceImagePath)
+		sourceImg, err = readImage(sourceImagePath, *maxPixels)
+		if err != nil {
+			fatalf("Error reading source image: %v", err)
+		}
+	}
+	if strings.EqualFold(*paletteName, "source") {
+		// 在旋转、翻转之前取调色板，变换后的图像不再是索引色图像
+		if gifPalette, err = sourcePalette(sourceImg); err != nil {
+			fatalf("Error: %v", err)
+		}
+		log.Printf("Using the %d-color palette of the source image.", len(gifPalette))
+	}
+	sourceImg, err = Transform{Rotate: *rotate, Flip: *flip}.Apply(sourceImg)
 	if err != nil {
-		log.Fatalf("Error reading target image: %v", err)
+		fatalf("Error transforming source image: %v", err)
 	}
 
-	if sourceImg.Bounds() != targetImg.Bounds() {
-		log.Fatalf("Error: Source and target image dimensions must be the same.")
+	var targetImg image.Image
+	if command == "text" {
+		targetImg = textTarget
+	} else if command == "fade" {
+		log.Printf("Creating a solid %s target image...", targetImagePath)
+		targetImg = solidImage(sourceImg.Bounds(), fadeColor)
+	} else if *blurSigma > 0 {
+		if targetImagePath != sourceImagePath {
+			fatalf("Error: -blur requires the target to be the same file as the source.")
+		}
+		log.Printf("Blurring source image with sigma %.2f to create the target...", *blurSigma)
+		targetImg = GaussianBlur(sourceImg, *blurSigma)
+	} else {
+		log.Printf("Reading target image: %s", targetImagePath)
+		targetImg, err = readImage(targetImagePath, *maxPixels)
+		if err != nil {
+			fatalf("Error reading target image: %v", err)
+		}
+	}
+
+	if sourceImg, targetImg, err = applyInvert(*invert, sourceImg, targetImg); err != nil {
+		fatalf("Error: %v", err)
+	}
+	if err := checkDimensions(sourceImg, targetImg); err != nil {
+		fatalf("Error: %v", err)
+	}
+	// -mask 和 -anchors 是相对于完整图片给出的，裁剪后用 cropOffset 把坐标换算回完整图片
+	full := sourceImg.Bounds()
+	cropOffset := full.Min
+	if *cropContent {
+		var r image.Rectangle
+		if sourceImg, targetImg, r, err = cropToContent(sourceImg, targetImg, *cropTolerance); err != nil {
+			fatalf("Error: %v", err)
+		}
+		cropOffset = r.Min
+		log.Printf("Cropped to content: %dx%d at (%d,%d), %.1f%% of the original pixels.",
+			r.Dx(), r.Dy(), r.Min.X-full.Min.X, r.Min.Y-full.Min.Y, float64(r.Dx()*r.Dy())*100/float64(full.Dx()*full.Dy()))
+	}
+
+	var motionSeed int64
+	if *seedFromImage {
+		motionSeed = imageSeed(sourceImg, targetImg)
+		planOpts.Seed = motionSeed
+		log.Printf("Using seed %d derived from the input images.", motionSeed)
+	}
+
+	if *debugGray != "" {
+		if err := SaveGrayscaleDebug(sourceImg, targetImg, *debugGray); err != nil {
+			fatalf("Error saving grayscale debug image: %v", err)
+		}
+	}
+
+	// 只对部分像素进行重排的筛选条件，多个条件同时满足的像素才参与重排
+	var keep func(x, y int) bool
+	if *alphaThreshold > 0 {
+		keep = alphaAtLeast(sourceImg, *alphaThreshold)
+	}
+	if *changedOnly {
+		keep = bothKeep(keep, changedPixels(sourceImg, targetImg))
+	}
+	if *maskPath != "" {
+		log.Printf("Reading mask image: %s", *maskPath)
+		mask, err := readMask(*maskPath, full, *maxPixels)
+		if err != nil {
+			fatalf("Error reading mask image: %v", err)
+		}
+		keep = bothKeep(keep, shiftKeep(mask, sourceImg.Bounds().Min, cropOffset))
+	}
+	if *anchors != "" {
+		pinned, err := parseAnchors(*anchors, full)
+		if err != nil {
+			fatalf("Error: %v", err)
+		}
+		keep = bothKeep(keep, shiftKeep(pinned, sourceImg.Bounds().Min, cropOffset))
+	}
+	if *blockSize > 1 && keep != nil {
+		fatalf("Error: -blocksize cannot be combined with -alphathreshold, -changed-only, -mask or -anchors.")
+	}
+	if *blockSize > 1 && *savePlan != "" {
+		fatalf("Error: -saveplan cannot be combined with -blocksize.")
 	}
 
-	log.Printf("Creating animation plan using '%s' algorithm...", algorithm)
 	var plan *AnimationPlan
-	switch algorithm {
-	case "default":
-		plan = CreateAnimationPlan(sourceImg, targetImg)
-	case "featured":
-		plan = CreateAnimationPlanFeatured(sourceImg, targetImg)
-	default:
-		log.Fatalf("Unknown algorithm: %s. Please use 'default' or 'featured'.", algorithm)
+	if *blockSize > 1 {
+		plan, err = createBlockPlan(algorithm, sourceImg, targetImg, *blockSize, planOpts)
+	} else if keep != nil {
+		plan, err = createMaskedPlan(algorithm, sourceImg, targetImg, keep, planOpts)
+	} else {
+		plan, err = createPlan(algorithm, sourceImg, targetImg, planOpts)
+	}
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+	if *savePlan != "" {
+		if err := SavePlanJSON(plan, *savePlan); err != nil {
+			fatalf("Error saving plan: %v", err)
+		}
+		log.Printf("Animation plan saved to: %s", *savePlan)
 	}
 
 	switch command {
-	case "gif":
+	case "gif", "fade", "text":
+		strategy, err := parseCapStrategy(*capStrategy)
+		if err != nil {
+			fatalf("Error: %v", err)
+		}
+		if *paletteFrom != "" {
+			log.Printf("Building the GIF palette from style image: %s", *paletteFrom)
+			styleImg, err := readImage(*paletteFrom, *maxPixels)
+			if err != nil {
+				fatalf("Error reading palette image: %v", err)
+			}
+			gifPalette = paletteFromImage(styleImg)
+			log.Printf("The style palette has %d colors.", len(gifPalette))
+		}
 		log.Println("Saving animation as GIF...")
-		err := SaveGIF(plan, outputPath, frameDelay)
+		frameOpts := FrameOptions{
+			FrameStep:       *frameStep,
+			Motion:          *motion,
+			Seed:            motionSeed,
+			SkipSource:      *noSource,
+			DebugBackground: *debugBG,
+			Flash:           *flash,
+			MaxStep:         *maxStep,
+			WaveWidth:       *waveWidth,
+			Jitter:          *jitter,
+		}
+		// -maxframes、-duration 和 -explain 模拟的渲染也计入 -timeout
+		defer withTimeout(&frameOpts, *timeout)()
+		if *maxFrames > 0 {
+			if frameOpts.Seed == 0 {
+				// 固定随机运动的种子，使实际生成的帧数与限制帧数时模拟的帧数一致
+				frameOpts.Seed = time.Now().UnixNano()
+			}
+			// -boomerang 的返回段几乎使帧数翻倍，因此按加上返回段后的总帧数限制正向动画
+			capped, err := capFrameCount(plan, frameOpts, forwardFrameLimit(*maxFrames, *boomerang), strategy)
+			if err != nil {
+				exitOnTimeout(err, *timeout, outputPath)
+				fatalf("Error: %v", err)
+			}
+			if capped.Speed > 1 {
+				log.Printf("Moving pixels %dx faster to stay within -maxframes %d.", capped.Speed, *maxFrames)
+			} else if capped.FrameStep > frameOpts.FrameStep {
+				if strategy == "speed" {
+					// 提速省不掉首帧和末帧，上限太小时只能抽帧
+					log.Printf("-maxframes %d is too small to reach by speeding up; skipping frames instead.", *maxFrames)
+				}
+				log.Printf("Raising -framestep from %d to %d to stay within -maxframes %d.", frameOpts.FrameStep, capped.FrameStep, *maxFrames)
+			}
+			frameOpts = capped
+		}
+		if *duration > 0 {
+			if frameOpts.Seed == 0 {
+				// 固定随机运动的种子，使实际生成的帧数与计算延迟时模拟的帧数一致
+				frameOpts.Seed = time.Now().UnixNano()
+			}
+			delay, step, frames, err := delayForDuration(plan, frameOpts, *duration, *boomerang)
+			if err != nil {
+				exitOnTimeout(err, *timeout, outputPath)
+				fatalf("Error: %v", err)
+			}
+			if step > frameOpts.FrameStep {
+				log.Printf("Raising -framestep from %d to %d so every frame lasts at least 1/100 s.", frameOpts.FrameStep, step)
+				frameOpts.FrameStep = step
+			}
+			frameDelay = delay
+			log.Printf("Using a frame delay of %d/100 s for %d frames to last about %s.", delay, frames, *duration)
+		}
+		if *explain && frameOpts.Seed == 0 {
+			// 固定随机运动的种子，使报告的帧数与实际生成的一致
+			frameOpts.Seed = time.Now().UnixNano()
+		}
+		gifOpts := GIFOptions{
+			FrameOptions:    frameOpts,
+			Palette:         gifPalette,
+			AdaptivePalette: strings.EqualFold(*paletteName, "adaptive") && *paletteFrom == "",
+			ExactPalette:    exactPaletteFor(*paletteName) && *paletteFrom == "",
+			Dither:          dither,
+			Lossy:           *lossy,
+			Boomerang:       *boomerang,
+			InvertReturn:    *invertReturn,
+			Transparent:     *transparent,
+			Background:      background,
+			Spool:           *spool,
+			Trim:            *trim,
+			LoopDelay:       *loopDelay,
+			OutSize:         outputSize,
+		}
+		if *explain {
+			summary, err := summarizeRender(plan, gifOpts, frameDelay)
+			if err != nil {
+				exitOnTimeout(err, *timeout, outputPath)
+				fatalf("Error: %v", err)
+			}
+			summary.Algorithm = algorithm
+			summary.Seed = planOpts.Seed
+			summary.Palette = *paletteName
+			if *paletteFrom != "" {
+				summary.Palette = fmt.Sprintf("%d colors from %s", len(gifPalette), *paletteFrom)
+			}
+			writeSummary(os.Stderr, summary)
+		}
+		result, err := SaveGIF(plan, outputPath, frameDelay, gifOpts)
 		if err != nil {
-			log.Fatalf("Error saving GIF: %v", err)
+			exitOnTimeout(err, *timeout, outputPath)
+			fatalf("Error saving GIF: %v", err)
+		}
+		if *stats {
+			path := statsPath(outputPath)
+			err := saveStats(path, renderStats{
+				Algorithm:      algorithm,
+				Frames:         result.Frames,
+				Width:          result.Width,
+				Height:         result.Height,
+				TotalTravel:    TotalDistance(plan, Euclidean),
+				Seed:           planOpts.Seed,
+				MotionSeed:     frameOpts.Seed,
+				ElapsedSeconds: time.Since(start).Seconds(),
+			})
+			if err != nil {
+				fatalf("Error saving stats: %v", err)
+			}
+			log.Printf("Render statistics saved to: %s", path)
+		}
+		if *lossy > 0 {
+			// 再以无损方式编码一次（只统计大小，不写文件），报告 -lossy 节省的空间
+			log.Println("Encoding a lossless GIF to measure the savings of -lossy...")
+			baseline := gifOpts
+			baseline.Lossy = 0
+			baselineSize, err := encodedGIFSize(plan, frameDelay, baseline)
+			if err != nil {
+				fatalf("Error encoding baseline GIF: %v", err)
+			}
+			info, err := os.Stat(outputPath)
+			if err != nil {
+				fatalf("Error reading GIF size: %v", err)
+			}
+			saved := baselineSize - info.Size()
+			log.Printf("Lossy GIF is %d bytes, lossless would be %d bytes (saved %d bytes, %.1f%%).",
+				info.Size(), baselineSize, saved, float64(saved)*100/float64(baselineSize))
+		}
+		if *timestamps != "" {
+			if err := SaveTimestamps(result.Delays, *timestamps); err != nil {
+				fatalf("Error saving timestamps: %v", err)
+			}
+			log.Printf("Timestamps for %d frames saved to: %s", len(result.Delays), *timestamps)
 		}
 		log.Println("GIF animation created successfully!")
 	case "image":
 		log.Println("Saving final image...")
-		err := SaveImage(plan, outputPath)
+		err := SaveImage(plan, outputPath, imageOpts)
 		if err != nil {
-			log.Fatalf("Error saving image: %v", err)
+			fatalf("Error saving image: %v", err)
 		}
 		log.Printf("Image saved successfully to: %s", outputPath)
+	case "endpoints":
+		log.Println("Saving first and last frames...")
+		startPath, endPath, err := SaveEndpoints(plan, outputPath)
+		if err != nil {
+			fatalf("Error saving endpoints: %v", err)
+		}
+		log.Printf("Endpoints saved successfully to: %s and %s", startPath, endPath)
+	case "montage":
+		err := SaveMontage(sourceImg, targetImg, plan, algorithm, outputPath)
+		if err != nil {
+			fatalf("Error saving montage: %v", err)
+		}
+		log.Printf("Montage saved successfully to: %s", outputPath)
 	}
 }
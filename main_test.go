@@ -0,0 +1,14 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+)
+
+// TestMain 丢弃库函数的中文进度日志，只保留测试本身的输出
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
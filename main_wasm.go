@@ -0,0 +1,71 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"syscall/js"
+)
+
+// main 在浏览器中把 createGif 注册为全局 JavaScript 函数，并保持 Go 运行时存活
+func main() {
+	js.Global().Set("createGif", js.FuncOf(createGif))
+	select {}
+}
+
+// createGif 是暴露给 JavaScript 的入口：
+//
+//	createGif(sourceBytes: Uint8Array, targetBytes: Uint8Array, delay: number, algorithm?: string)
+//
+// 成功时返回包含 GIF 文件内容的 Uint8Array，失败时返回一个 Error 对象
+func createGif(this js.Value, args []js.Value) any {
+	gifBytes, err := createGifBytes(args)
+	if err != nil {
+		return js.Global().Get("Error").New(err.Error())
+	}
+	result := js.Global().Get("Uint8Array").New(len(gifBytes))
+	js.CopyBytesToJS(result, gifBytes)
+	return result
+}
+
+// createGifBytes 解析 JavaScript 参数，计算动画计划并返回编码后的 GIF
+func createGifBytes(args []js.Value) ([]byte, error) {
+	if len(args) < 3 {
+		return nil, fmt.Errorf("usage: createGif(sourceBytes, targetBytes, delay, [algorithm])")
+	}
+	algorithm := "default"
+	if len(args) > 3 && args[3].Type() == js.TypeString {
+		algorithm = args[3].String()
+	}
+
+	sourceImg, err := decodeImageBytes(jsBytes(args[0]), "source", defaultMaxPixels)
+	if err != nil {
+		return nil, err
+	}
+	targetImg, err := decodeImageBytes(jsBytes(args[1]), "target", defaultMaxPixels)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDimensions(sourceImg, targetImg); err != nil {
+		return nil, err
+	}
+
+	plan, err := createPlan(algorithm, sourceImg, targetImg, PlanOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if _, err := EncodeGIF(&buf, plan, args[2].Int(), GIFOptions{}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// jsBytes 把 JavaScript 的 Uint8Array 复制为 Go 字节切片
+func jsBytes(v js.Value) []byte {
+	data := make([]byte, v.Get("length").Int())
+	js.CopyBytesToGo(data, v)
+	return data
+}
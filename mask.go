@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// pixelMask 是图像可以实现的可选接口：imagePixels 只会产生 Keep 返回 true 的像素。
+// 这样所有注册的算法无需修改即可只对部分像素进行重排，而邻域特征（如区间深度、边缘强度）
+// 仍然基于完整的图像计算
+type pixelMask interface {
+	Keep(x, y int) bool
+}
+
+// maskedImage 给图像附加一个像素筛选条件，At 等方法仍返回原图的内容
+type maskedImage struct {
+	image.Image
+	keep func(x, y int) bool
+}
+
+func (m maskedImage) Keep(x, y int) bool { return m.keep(x, y) }
+
+// createMaskedPlan 只对 keep 返回 true 的位置进行重排：源图中这些位置的像素被分配到目标图中同一组位置，
+// 其余源像素作为静止的像素加入计划（起点和终点相同），在每一帧中都作为背景保持不动
+func createMaskedPlan(name string, sourceImg, targetImg image.Image, keep func(x, y int) bool, opts PlanOptions) (*AnimationPlan, error) {
+	plan, err := createPlan(name, maskedImage{sourceImg, keep}, maskedImage{targetImg, keep}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	moving := len(plan.Pixels)
+	bounds := sourceImg.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if keep(x, y) {
+				continue
+			}
+			plan.Pixels = append(plan.Pixels, AnimationPixel{
+				StartX:  x,
+				StartY:  y,
+				TargetX: x,
+				TargetY: y,
+				Color:   toRGBA(sourceImg.At(x, y)),
+			})
+		}
+	}
+	log.Printf("%d pixels move, %d pixels stay fixed.", moving, len(plan.Pixels)-moving)
+	return plan, nil
+}
+
+// alphaAtLeast 返回一个筛选条件：只保留图像中 alpha 不小于 threshold 的位置
+func alphaAtLeast(img image.Image, threshold int) func(x, y int) bool {
+	return func(x, y int) bool {
+		return int(toRGBA(img.At(x, y)).A) >= threshold
+	}
+}
+
+// changedPixels 返回一个筛选条件：只保留源图像和目标图像颜色不同的位置
+func changedPixels(sourceImg, targetImg image.Image) func(x, y int) bool {
+	return func(x, y int) bool {
+		return toRGBA(sourceImg.At(x, y)) != toRGBA(targetImg.At(x, y))
+	}
+}
+
+// bothKeep 返回同时满足 a 和 b 的筛选条件，a 为 nil 时直接返回 b
+func bothKeep(a, b func(x, y int) bool) func(x, y int) bool {
+	if a == nil {
+		return b
+	}
+	return func(x, y int) bool { return a(x, y) && b(x, y) }
+}
+
+// shiftKeep 返回在平移后的图像上使用 keep 的筛选条件：平移后的图像中的 from 对应 keep 所用坐标中的 to，
+// 例如 -crop-to-content 裁剪后，用相对于完整图片读取的遮罩和锚点筛选裁剪后的像素。from 与 to 相同时直接返回 keep
+func shiftKeep(keep func(x, y int) bool, from, to image.Point) func(x, y int) bool {
+	if from == to {
+		return keep
+	}
+	d := to.Sub(from)
+	return func(x, y int) bool { return keep(x+d.X, y+d.Y) }
+}
+
+// parseAnchors 解析 "x1,y1;x2,y2;..." 形式的锚点坐标（相对于图像左上角），返回一个筛选条件：
+// 排除这些位置，使锚点上的像素不参与重排、保持不动。坐标必须在 bounds 之内
+func parseAnchors(s string, bounds image.Rectangle) (func(x, y int) bool, error) {
+	anchors := map[image.Point]bool{}
+	for _, item := range strings.Split(s, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		xs, ys, ok := strings.Cut(item, ",")
+		x, errX := strconv.Atoi(strings.TrimSpace(xs))
+		y, errY := strconv.Atoi(strings.TrimSpace(ys))
+		if !ok || errX != nil || errY != nil {
+			return nil, fmt.Errorf("invalid anchor %q: use x,y", item)
+		}
+		p := bounds.Min.Add(image.Pt(x, y))
+		if !p.In(bounds) {
+			return nil, fmt.Errorf("anchor %d,%d is outside the %dx%d image", x, y, bounds.Dx(), bounds.Dy())
+		}
+		anchors[p] = true
+	}
+	if len(anchors) == 0 {
+		return nil, fmt.Errorf("no anchors in %q", s)
+	}
+	return func(x, y int) bool {
+		return !anchors[image.Pt(x, y)]
+	}, nil
+}
+
+// readMask 读取黑白遮罩图片，返回一个筛选条件：只保留遮罩中偏白（灰度不小于 128）的位置。
+// 完全透明的遮罩像素视为黑色。遮罩的尺寸必须与 bounds 相同
+func readMask(path string, bounds image.Rectangle, maxPixels int) (func(x, y int) bool, error) {
+	mask, err := readImage(path, maxPixels)
+	if err != nil {
+		return nil, err
+	}
+	if mask.Bounds() != bounds {
+		mb := mask.Bounds()
+		return nil, fmt.Errorf("%w: mask %s is %dx%d, images are %dx%d", ErrDimensionMismatch, path, mb.Dx(), mb.Dy(), bounds.Dx(), bounds.Dy())
+	}
+	return func(x, y int) bool {
+		return grayscaleOf(toRGBA(mask.At(x, y))) >= 128
+	}, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// TestCropKeepsMaskAndAnchors 检查 -crop-to-content 之后，相对于完整图片给出的遮罩和锚点仍然指向完整图片中的同一位置
+func TestCropKeepsMaskAndAnchors(t *testing.T) {
+	full := image.Rect(0, 0, 10, 10)
+	source, target := image.NewRGBA(full), image.NewRGBA(full)
+	for y := 2; y < 8; y++ {
+		for x := 2; x < 8; x++ {
+			source.SetRGBA(x, y, color.RGBA{uint8(x * 20), uint8(y * 20), 0x80, 0xFF})
+			target.SetRGBA(x, y, color.RGBA{0x80, uint8(x * 20), uint8(y * 20), 0xFF})
+		}
+	}
+	src, _, r, err := cropToContent(source, target, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != image.Rect(2, 2, 8, 8) {
+		t.Fatalf("cropped to %v, want (2,2)-(8,8)", r)
+	}
+
+	// 遮罩只保留完整图片中 x == 5 的一列，对应裁剪后的 x == 3
+	mask := shiftKeep(func(x, y int) bool { return x == 5 }, src.Bounds().Min, r.Min)
+	anchors, err := parseAnchors("5,5", full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned := shiftKeep(anchors, src.Bounds().Min, r.Min)
+	for y := 0; y < r.Dy(); y++ {
+		for x := 0; x < r.Dx(); x++ {
+			if got, want := mask(x, y), x == 3; got != want {
+				t.Errorf("mask at cropped (%d,%d) = %v, want %v", x, y, got, want)
+			}
+			if got, want := pinned(x, y), !(x == 3 && y == 3); got != want {
+				t.Errorf("anchor filter at cropped (%d,%d) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
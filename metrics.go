@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"math"
+	"math/rand"
+)
+
+// RMSE 计算两张图像在 R、G、B 三个通道上的均方根误差（0-255 范围），两张图像必须尺寸相同
+func RMSE(a, b image.Image) float64 {
+	ab, bb := a.Bounds(), b.Bounds()
+	var sum float64
+	n := 0
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			ca := toRGBA(a.At(ab.Min.X+x, ab.Min.Y+y))
+			cb := toRGBA(b.At(bb.Min.X+x, bb.Min.Y+y))
+			dr := float64(ca.R) - float64(cb.R)
+			dg := float64(ca.G) - float64(cb.G)
+			db := float64(ca.B) - float64(cb.B)
+			sum += dr*dr + dg*dg + db*db
+			n += 3
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return math.Sqrt(sum / float64(n))
+}
+
+// paletteStrategy 是比较调色板时使用的一种 GIF 调色板设置
+type paletteStrategy struct {
+	Name string
+	Opts GIFOptions
+}
+
+// paletteStrategies 返回 comparePalettes 比较的调色板：固定的 Plan9 和 Web 安全色、自适应调色板，
+// 以及颜色不超过 256 种时无损的精确调色板（颜色更多时与 plan9 相同）
+func paletteStrategies() []paletteStrategy {
+	return []paletteStrategy{
+		{"plan9", GIFOptions{Palette: palette.Plan9}},
+		{"websafe", GIFOptions{Palette: webSafePalette()}},
+		{"adaptive", GIFOptions{AdaptivePalette: true}},
+		{"exact", GIFOptions{ExactPalette: true}},
+	}
+}
+
+// paletteResult 是一种调色板的比较结果
+type paletteResult struct {
+	Name string
+	// Bytes 是编码出的 GIF 的大小
+	Bytes int
+	// MeanRMSE 和 MaxRMSE 是解码后的每一帧与真彩色渲染帧之间 RMSE 的平均值和最大值
+	MeanRMSE, MaxRMSE float64
+}
+
+// comparePalettes 用每一种调色板把同一个动画编码为 GIF，再解码与真彩色的渲染帧逐帧比较，
+// 客观地衡量各种调色板在画质和文件大小之间的取舍。opts 的 Seed 为 0 时 random 运动每次编码都不同，
+// 调用方应固定种子或使用确定性的运动方式
+func comparePalettes(plan *AnimationPlan, delay int, opts FrameOptions) ([]paletteResult, error) {
+	var truth []*image.RGBA
+	if _, err := RenderFrames(plan, opts, func(frame *image.RGBA) {
+		truth = append(truth, frame)
+	}); err != nil {
+		return nil, err
+	}
+	var results []paletteResult
+	for _, s := range paletteStrategies() {
+		gifOpts := s.Opts
+		gifOpts.FrameOptions = opts
+		var buf bytes.Buffer
+		if _, err := EncodeGIF(&buf, plan, delay, gifOpts); err != nil {
+			return nil, err
+		}
+		r := paletteResult{Name: s.Name, Bytes: buf.Len()}
+		decoded, err := gif.DecodeAll(&buf)
+		if err != nil {
+			return nil, err
+		}
+		if len(decoded.Image) != len(truth) {
+			return nil, fmt.Errorf("%s: decoded %d frames, rendered %d", s.Name, len(decoded.Image), len(truth))
+		}
+		for i, frame := range decoded.Image {
+			rmse := RMSE(truth[i], frame)
+			r.MeanRMSE += rmse / float64(len(truth))
+			r.MaxRMSE = max(r.MaxRMSE, rmse)
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// quantize 按照 SaveGIF 的方式把图像转换为使用指定调色板的图像，dither 决定量化方式（见 ditherByName）
+func quantize(img image.Image, p color.Palette, dither draw.Drawer) *image.Paletted {
+	bounds := img.Bounds()
+	paletted := image.NewPaletted(bounds, p)
+	dither.Draw(paletted, bounds, img, bounds.Min)
+	return paletted
+}
+
+// crossingsSampleSize 是 TotalCrossings 精确计算的最大轨迹数，超过时改为抽样估计
+const crossingsSampleSize = 2000
+
+// segment 是一个像素从起点到终点的直线轨迹
+type segment struct {
+	x0, y0, x1, y1 int
+}
+
+// orientation 返回点 c 相对于有向线段 ab 的方向：1 为逆时针，-1 为顺时针，0 为共线
+func orientation(ax, ay, bx, by, cx, cy int) int {
+	v := (bx-ax)*(cy-ay) - (by-ay)*(cx-ax)
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
+
+// crosses 判断两条轨迹是否严格相交（各自的端点分别位于另一条线段的两侧），
+// 共线或仅在端点接触的情况不算交叉
+func crosses(a, b segment) bool {
+	return orientation(a.x0, a.y0, a.x1, a.y1, b.x0, b.y0)*orientation(a.x0, a.y0, a.x1, a.y1, b.x1, b.y1) < 0 &&
+		orientation(b.x0, b.y0, b.x1, b.y1, a.x0, a.y0)*orientation(b.x0, b.y0, b.x1, b.y1, a.x1, a.y1) < 0
+}
+
+// TotalCrossings 统计计划中有多少对像素轨迹（起点到终点的直线）相互交叉，用于客观比较不同分配算法的“混乱”程度。
+// 不移动的像素不参与统计。移动的像素超过 crossingsSampleSize 个时，用固定种子随机抽取
+// crossingsSampleSize 条轨迹两两比较，再按总的轨迹对数放大得到估计值
+func TotalCrossings(plan *AnimationPlan) int {
+	count, _ := countCrossings(plan)
+	return count
+}
+
+// countCrossings 返回交叉数以及该结果是否为精确值
+func countCrossings(plan *AnimationPlan) (int, bool) {
+	var segments []segment
+	for _, ap := range plan.Pixels {
+		if ap.StartX != ap.TargetX || ap.StartY != ap.TargetY {
+			segments = append(segments, segment{ap.StartX, ap.StartY, ap.TargetX, ap.TargetY})
+		}
+	}
+
+	n := len(segments)
+	exact := n <= crossingsSampleSize
+	if !exact {
+		r := rand.New(rand.NewSource(1))
+		// 部分 Fisher-Yates 洗牌，前 crossingsSampleSize 条即为随机样本
+		for i := 0; i < crossingsSampleSize; i++ {
+			j := i + r.Intn(n-i)
+			segments[i], segments[j] = segments[j], segments[i]
+		}
+		segments = segments[:crossingsSampleSize]
+	}
+
+	count := 0
+	for i := range segments {
+		for j := i + 1; j < len(segments); j++ {
+			if crosses(segments[i], segments[j]) {
+				count++
+			}
+		}
+	}
+	if exact {
+		return count, true
+	}
+	k := float64(len(segments))
+	scale := float64(n) * float64(n-1) / (k * (k - 1))
+	return int(math.Round(float64(count) * scale)), false
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+// TestComparePalettes 对每一对夹具图片比较各种调色板：误差不能超过 RMSE 的理论上限，
+// 颜色不超过 256 种时精确调色板必须完全无损，根据图片颜色计算的 adaptive 调色板不能比通用的 plan9 更差
+func TestComparePalettes(t *testing.T) {
+	for _, fx := range fixturePairs() {
+		t.Run(fx.Name, func(t *testing.T) {
+			results, err := comparePalettes(CreateAnimationPlan(fx.Source, fx.Target, PlanOptions{}), 1, FrameOptions{Motion: "deterministic"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			byName := map[string]paletteResult{}
+			for _, r := range results {
+				t.Logf("%s: %d bytes, mean RMSE %.2f, max %.2f", r.Name, r.Bytes, r.MeanRMSE, r.MaxRMSE)
+				if r.MeanRMSE < 0 || r.MaxRMSE > 255 || r.MeanRMSE > r.MaxRMSE+1e-9 {
+					t.Errorf("%s: implausible RMSE: mean %f, max %f", r.Name, r.MeanRMSE, r.MaxRMSE)
+				}
+				byName[r.Name] = r
+			}
+			if n := UniqueColors(fx.Source); n < maxPaletteSize && byName["exact"].MaxRMSE != 0 {
+				t.Errorf("the exact palette lost colors of a %d-color animation: max RMSE %f", n, byName["exact"].MaxRMSE)
+			}
+			if adaptive, plan9 := byName["adaptive"], byName["plan9"]; adaptive.MeanRMSE > plan9.MeanRMSE {
+				t.Errorf("adaptive mean RMSE %.2f is worse than plan9 %.2f", adaptive.MeanRMSE, plan9.MeanRMSE)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+// mjpegBoundary 是 Motion-JPEG 流中分隔各帧的边界字符串
+const mjpegBoundary = "img2videoframe"
+
+// MJPEGContentType 是 SaveMJPEG 输出的流的 Content-Type，HTTP 服务返回流时应使用这个响应头，
+// 浏览器的 <img> 标签会在每一帧到达时替换显示的图像
+const MJPEGContentType = "multipart/x-mixed-replace; boundary=" + mjpegBoundary
+
+// mjpegQuality 是每一帧的 JPEG 质量
+const mjpegQuality = 85
+
+// SaveMJPEG 根据 AnimationPlan 生成动画帧，把每一帧编码为 JPEG，以 multipart/x-mixed-replace 的格式写入 w。
+// fps 大于 0 时按该帧率控制写出的节奏，适合实时推送给浏览器；为 0 时尽快写出所有帧。
+// JPEG 不支持透明度，透明的像素显示为黑色
+func SaveMJPEG(plan *AnimationPlan, w io.Writer, fps int, opts FrameOptions) error {
+	if fps < 0 {
+		return fmt.Errorf("invalid frame rate %d", fps)
+	}
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(mjpegBoundary); err != nil {
+		return err
+	}
+
+	var tick <-chan time.Time
+	if fps > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(fps))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var buf bytes.Buffer
+	var writeErr error
+	_, err := RenderFrames(plan, opts, func(frame *image.RGBA) {
+		if writeErr != nil {
+			return
+		}
+		buf.Reset()
+		if writeErr = jpeg.Encode(&buf, frame, &jpeg.Options{Quality: mjpegQuality}); writeErr != nil {
+			return
+		}
+		if tick != nil {
+			<-tick
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":   {"image/jpeg"},
+			"Content-Length": {strconv.Itoa(buf.Len())},
+		})
+		if err != nil {
+			writeErr = err
+			return
+		}
+		_, writeErr = part.Write(buf.Bytes())
+	})
+	if err != nil {
+		return err
+	}
+	if writeErr != nil {
+		return fmt.Errorf("failed to write MJPEG frame: %w", writeErr)
+	}
+	return mw.Close()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+)
+
+// montagePanel 是拼图中的一格：一张图片和它上方的标签
+type montagePanel struct {
+	Label string
+	Image image.Image
+}
+
+// 拼图的布局参数
+const (
+	montagePadding    = 10
+	montageLabelScale = 2
+)
+
+var (
+	montageBackground = color.RGBA{0x20, 0x20, 0x20, 0xFF}
+	montageLabelColor = color.RGBA{0xF0, 0xF0, 0xF0, 0xFF}
+)
+
+// renderMontage 把多张图片按 columns 列排成网格，每张图片上方绘制标签
+func renderMontage(panels []montagePanel, columns int) *image.RGBA {
+	columns = max(1, min(columns, len(panels)))
+	rows := (len(panels) + columns - 1) / columns
+
+	// 每一格的大小取所有图片中最大的宽和高，标签过长时加宽格子
+	cellW, cellH := 0, 0
+	for _, p := range panels {
+		cellW = max(cellW, p.Image.Bounds().Dx(), textWidth(p.Label, montageLabelScale))
+		cellH = max(cellH, p.Image.Bounds().Dy())
+	}
+	labelH := glyphHeight*montageLabelScale + montagePadding
+
+	width := columns*(cellW+montagePadding) + montagePadding
+	height := rows*(labelH+cellH+montagePadding) + montagePadding
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(montageBackground), image.Point{}, draw.Src)
+
+	for i, p := range panels {
+		x := montagePadding + (i%columns)*(cellW+montagePadding)
+		y := montagePadding + (i/columns)*(labelH+cellH+montagePadding)
+		drawText(canvas, x, y, p.Label, montageLabelScale, montageLabelColor)
+
+		b := p.Image.Bounds()
+		dst := image.Rect(x, y+labelH, x+b.Dx(), y+labelH+b.Dy())
+		draw.Draw(canvas, dst, p.Image, b.Min, draw.Over)
+	}
+	return canvas
+}
+
+// SaveMontage 把源图、目标图和重排结果横向排列，保存为一张带标签的 PNG
+func SaveMontage(sourceImg, targetImg image.Image, plan *AnimationPlan, algorithm, outputPath string) error {
+	log.Printf("正在生成对比拼图...")
+	canvas := renderMontage([]montagePanel{
+		{Label: "Source", Image: sourceImg},
+		{Label: "Target", Image: targetImg},
+		{Label: "Result (" + algorithm + ")", Image: renderTarget(plan)},
+	}, 3)
+
+	log.Printf("正在将拼图保存到 %s...", outputPath)
+	return savePNG(canvas, outputPath)
+}
+
+// algorithmResult 是 compare-algos 中一种算法的计算结果
+type algorithmResult struct {
+	Name         string
+	Plan         *AnimationPlan
+	MeanDistance float64
+}
+
+// compareAlgorithms 用所有注册的算法分别计算同一对图像的计划，按算法名称排序返回
+func compareAlgorithms(sourceImg, targetImg image.Image, opts PlanOptions) ([]algorithmResult, error) {
+	var results []algorithmResult
+	for _, name := range algorithmNames() {
+		plan, err := createPlan(name, sourceImg, targetImg, opts)
+		if err != nil {
+			return nil, err
+		}
+		mean := TotalDistance(plan, Euclidean) / float64(max(1, len(plan.Pixels)))
+		results = append(results, algorithmResult{Name: name, Plan: plan, MeanDistance: mean})
+	}
+	return results, nil
+}
+
+// SaveAlgorithmComparison 把源图、目标图和每种算法的重排结果排成网格，保存为一张带标签的 PNG。
+// 每个结果的标签中包含算法名称、动画帧数和像素的平均移动距离
+func SaveAlgorithmComparison(sourceImg, targetImg image.Image, results []algorithmResult, outputPath string) error {
+	log.Printf("正在生成算法对比图...")
+	panels := []montagePanel{
+		{Label: "Source", Image: sourceImg},
+		{Label: "Target", Image: targetImg},
+	}
+	for _, r := range results {
+		panels = append(panels, montagePanel{
+			Label: fmt.Sprintf("%s: %d frames, d=%.1f", r.Name, r.Plan.Frames, r.MeanDistance),
+			Image: renderTarget(r.Plan),
+		})
+	}
+	columns := int(math.Ceil(math.Sqrt(float64(len(panels)))))
+	canvas := renderMontage(panels, columns)
+
+	log.Printf("正在将算法对比图保存到 %s...", outputPath)
+	return savePNG(canvas, outputPath)
+}
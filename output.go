@@ -1,155 +1,781 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"image"
+	"image/color"
 	"image/color/palette"
 	"image/draw"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
+	"io"
 	"log"
-	"math"
-	"math/rand"
 	"os"
 	"path/filepath"
-	"time"
+	"runtime"
+	"strings"
+	"sync"
 )
 
-// SaveGIF 根据 AnimationPlan 生成并保存 GIF 动画（随机步长）
-func SaveGIF(plan *AnimationPlan, outputPath string, delay int) error {
-	rand.Seed(time.Now().UnixNano())
-
-	var gifFrames []*image.Paletted
-	var gifDelays []int
-	gifPalette := palette.Plan9
-
-	// 存储每个像素的当前位置
-	type currentPixelState struct {
-		X, Y int
-	}
-	pixelStates := make([]currentPixelState, len(plan.Pixels))
-	for i, p := range plan.Pixels {
-		pixelStates[i] = currentPixelState{X: p.StartX, Y: p.StartY}
-	}
-
-	log.Println("正在生成随机步长动画...")
-
-	// 首先，将原图作为第一帧
-	firstFrame := image.NewRGBA(plan.Bounds)
-	for _, p := range plan.Pixels {
-		firstFrame.Set(p.StartX, p.StartY, p.Color)
-	}
-	palettedFirstFrame := image.NewPaletted(plan.Bounds, gifPalette)
-	draw.Draw(palettedFirstFrame, palettedFirstFrame.Bounds(), firstFrame, image.Point{}, draw.Src)
-	gifFrames = append(gifFrames, palettedFirstFrame)
-	gifDelays = append(gifDelays, delay) // 可以为第一帧设置不同的延迟，这里使用相同延迟
-
-	frameCount := 1 // 从第1帧开始计数（因为第0帧已经是原图）
-	for {
-		frameCount++
-		allArrived := true
-		currentFrameRGBA := image.NewRGBA(plan.Bounds)
-
-		for i, ap := range plan.Pixels {
-			state := &pixelStates[i]
-
-			// 如果还没到达，就移动它
-			if state.X != ap.TargetX || state.Y != ap.TargetY {
-				allArrived = false
-
-				// 计算到目标的距离
-				dx := ap.TargetX - state.X
-				dy := ap.TargetY - state.Y
-
-				// 根据图片尺寸计算缩放因子
-				scaleX := float64(plan.Bounds.Dx()) / 150.0
-				scaleY := float64(plan.Bounds.Dy()) / 150.0
-
-				// 获取基础随机步长 (1-3)
-				baseStepX := rand.Intn(3) + 1
-				baseStepY := rand.Intn(3) + 1
-
-				// 计算最终步长，并确保至少为 1
-				stepX := max(max(1, int(scaleX)), int(math.Round(float64(baseStepX)*scaleX)))
-				stepY := max(max(1, int(scaleY), int(math.Round(float64(baseStepY)*scaleY))))
-
-				// 移动 X 轴
-				if abs(dx) <= stepX {
-					state.X = ap.TargetX
-				} else if dx > 0 {
-					state.X += stepX
-				} else {
-					state.X -= stepX
-				}
-
-				// 移动 Y 轴
-				if abs(dy) <= stepY {
-					state.Y = ap.TargetY
-				} else if dy > 0 {
-					state.Y += stepY
-				} else {
-					state.Y -= stepY
-				}
+// webSafePalette 构建 216 色的 Web 安全调色板（每个通道取 0x00, 0x33, ..., 0xFF 六级）
+func webSafePalette() color.Palette {
+	p := make(color.Palette, 0, 216)
+	for r := 0; r < 6; r++ {
+		for g := 0; g < 6; g++ {
+			for b := 0; b < 6; b++ {
+				p = append(p, color.RGBA{uint8(r * 0x33), uint8(g * 0x33), uint8(b * 0x33), 0xFF})
 			}
-			currentFrameRGBA.Set(state.X, state.Y, ap.Color)
 		}
+	}
+	return p
+}
+
+// grayPalette 构建包含 256 级灰度的调色板
+func grayPalette() color.Palette {
+	p := make(color.Palette, 256)
+	for i := range p {
+		p[i] = color.Gray{Y: uint8(i)}
+	}
+	return p
+}
+
+// paletteByName 根据名称返回 GIF 使用的固定调色板。"adaptive" 和 "source" 返回 nil，
+// 表示调色板需要根据图像内容用 buildGlobalPalette 计算，或用 sourcePalette 从源图像中取得
+func paletteByName(name string) (color.Palette, error) {
+	switch strings.ToLower(name) {
+	case "adaptive", "source":
+		return nil, nil
+	case "", "plan9":
+		return palette.Plan9, nil
+	case "websafe":
+		return webSafePalette(), nil
+	case "gray", "grey":
+		return grayPalette(), nil
+	default:
+		return nil, fmt.Errorf("unknown palette: %s. Please use 'plan9', 'websafe', 'gray', 'adaptive' or 'source'", name)
+	}
+}
+
+// sourcePalette 返回索引色（调色板）源图像自带的调色板。动画中的像素都来自源图像，
+// 用它作为 GIF 调色板时每种颜色都能精确匹配，不会出现量化失真
+func sourcePalette(img image.Image) (color.Palette, error) {
+	paletted, ok := img.(*image.Paletted)
+	if !ok {
+		return nil, fmt.Errorf("-palette source requires an indexed (paletted) source image, got %T", img)
+	}
+	p := make(color.Palette, len(paletted.Palette))
+	copy(p, paletted.Palette)
+	return p, nil
+}
+
+// ditherByName 根据名称返回把 RGBA 帧量化到调色板时使用的 draw.Drawer
+func ditherByName(name string) (draw.Drawer, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return draw.Src, nil
+	case "floyd":
+		return draw.FloydSteinberg, nil
+	case "serpentine":
+		return serpentineDither{}, nil
+	default:
+		return nil, fmt.Errorf("unknown dither mode: %s. Please use 'none', 'floyd' or 'serpentine'", name)
+	}
+}
+
+// serpentineDither 是蛇形扫描（偶数行从左到右、奇数行从右到左）的 Floyd-Steinberg 误差扩散。
+// 标准库的 draw.FloydSteinberg 总是从左到右扫描，误差始终向同一方向扩散，渐变中容易出现斜向条纹；
+// 交替扫描方向可以消除这种方向性
+type serpentineDither struct{}
+
+// Draw 实现 draw.Drawer。目标不是调色板图像时退回标准库的 Floyd-Steinberg
+func (serpentineDither) Draw(dst draw.Image, r image.Rectangle, src image.Image, sp image.Point) {
+	pal, ok := dst.(*image.Paletted)
+	if !ok {
+		draw.FloydSteinberg.Draw(dst, r, src, sp)
+		return
+	}
+	r = r.Intersect(dst.Bounds())
+	w := r.Dx()
+	// 误差以 1/16 为单位累积，两端各留一个格子避免边界判断
+	cur := make([][4]int32, w+2)
+	next := make([][4]int32, w+2)
+	for y := 0; y < r.Dy(); y++ {
+		dir := 1
+		if y%2 == 1 {
+			dir = -1
+		}
+		for i := 0; i < w; i++ {
+			x := i
+			if dir < 0 {
+				x = w - 1 - i
+			}
+			c := toRGBA(src.At(sp.X+x, sp.Y+y))
+			var v [4]int32
+			for k, ch := range [4]uint8{c.R, c.G, c.B, c.A} {
+				v[k] = min(max(int32(ch)+(cur[x+1][k]+8)/16, 0), 255)
+			}
+			idx := pal.Palette.Index(color.RGBA{uint8(v[0]), uint8(v[1]), uint8(v[2]), uint8(v[3])})
+			pal.SetColorIndex(r.Min.X+x, r.Min.Y+y, uint8(idx))
+
+			p := toRGBA(pal.Palette[idx])
+			for k, ch := range [4]uint8{p.R, p.G, p.B, p.A} {
+				e := v[k] - int32(ch)
+				cur[x+1+dir][k] += e * 7
+				next[x+1-dir][k] += e * 3
+				next[x+1][k] += e * 5
+				next[x+1+dir][k] += e
+			}
+		}
+		cur, next = next, cur
+		clear(next)
+	}
+}
+
+// posterize 把图像每个颜色通道舍入到 2^bits 的倍数，减少颜色的种类。
+// alpha 通道保持不变，舍入后的值不超过 alpha 以保持合法的预乘颜色
+func posterize(img *image.RGBA, bits int) {
+	step := 1 << bits
+	for i := 0; i < len(img.Pix); i += 4 {
+		a := int(img.Pix[i+3])
+		for k := 0; k < 3; k++ {
+			v := (int(img.Pix[i+k]) + step/2) &^ (step - 1)
+			img.Pix[i+k] = uint8(min(v, a))
+		}
+	}
+}
+
+// frameJob 是一个等待转换为调色板图像的帧
+type frameJob struct {
+	index int
+	rgba  *image.RGBA
+}
+
+// frameConverter 使用多个 goroutine 并行地将 RGBA 帧转换为调色板帧，
+// 转换结果按照提交顺序保存，因此帧的顺序不会被打乱
+type frameConverter struct {
+	palette color.Palette
+	dither  draw.Drawer
+	lossy   int
+	// spool 不为 nil 时转换好的帧写入磁盘，frames 中只保留帧头
+	spool  *frameSpool
+	jobs   chan frameJob
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	frames []*image.Paletted
+}
+
+// newFrameConverter 创建并启动一个拥有 workers 个 goroutine 的帧转换器，dither 决定量化方式
+func newFrameConverter(p color.Palette, dither draw.Drawer, workers int) *frameConverter {
+	if workers < 1 {
+		workers = 1
+	}
+	c := &frameConverter{
+		palette: p,
+		dither:  dither,
+		jobs:    make(chan frameJob, workers),
+	}
+	c.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go c.work()
+	}
+	return c
+}
+
+func (c *frameConverter) work() {
+	defer c.wg.Done()
+	for job := range c.jobs {
+		if c.lossy > 0 {
+			posterize(job.rgba, c.lossy)
+		}
+		paletted := quantize(job.rgba, c.palette, c.dither)
+		// GIF 的逻辑屏幕从 (0, 0) 开始，原点不在 (0, 0) 的计划（例如子图像）的帧移到原点，只改变 Rect，像素数据不变
+		paletted.Rect = paletted.Rect.Sub(paletted.Rect.Min)
+		// 帧已经转换完毕，把 RGBA 缓冲区交还给池供后面的帧复用
+		releaseFrame(job.rgba)
+		if c.spool != nil {
+			paletted = c.spool.Store(job.index, paletted)
+		}
+		c.mu.Lock()
+		c.frames[job.index] = paletted
+		c.mu.Unlock()
+	}
+}
+
+// Add 提交一帧进行转换，提交后调用方不应再修改该帧
+func (c *frameConverter) Add(rgba *image.RGBA) {
+	c.mu.Lock()
+	index := len(c.frames)
+	c.frames = append(c.frames, nil)
+	c.mu.Unlock()
+	c.jobs <- frameJob{index: index, rgba: rgba}
+}
+
+// Wait 等待所有帧转换完成，并按提交顺序返回调色板帧
+func (c *frameConverter) Wait() []*image.Paletted {
+	close(c.jobs)
+	c.wg.Wait()
+	return c.frames
+}
+
+// GIFOptions 控制 SaveGIF 的可选行为
+type GIFOptions struct {
+	FrameOptions
+	// Palette 是每一帧使用的调色板，为 nil 时使用 Plan9
+	Palette color.Palette
+	// AdaptivePalette 为 true 时忽略 Palette，用 buildAnimationPalette 从首帧和末帧计算一个所有帧共用的调色板
+	AdaptivePalette bool
+	// ExactPalette 为 true 时先检查首帧和末帧的颜色数，不超过调色板容量时直接用这些颜色作为调色板（见 exactPalette），
+	// 不做任何量化，GIF 与渲染的帧完全一致；颜色过多时再按 Palette 和 AdaptivePalette 选择。设置了 Lossy 时不生效
+	ExactPalette bool
+	// Lossy 是量化前每个颜色通道舍去的低位数（0-7），颜色种类越少，相邻像素越容易相同，LZW 压缩率越高
+	Lossy int
+	// Dither 决定帧量化到调色板的方式（见 ditherByName），为 nil 时直接取最接近的颜色
+	Dither draw.Drawer
+	// Boomerang 为 true 时在正向动画之后倒序播放，回到源图像
+	Boomerang bool
+	// InvertReturn 为 true 时反转返回段每一帧的颜色（每个通道取 255-c），需要同时设置 Boomerang
+	InvertReturn bool
+	// OutSize 是输出帧的尺寸，动画按原始分辨率计算，编码前再缩放每一帧
+	OutSize OutputSize
+	// Trim 为 true 时把连续相同的帧合并为一帧，延迟相加，动画看起来不变但文件更小
+	Trim bool
+	// LoopDelay 大于 0 时把最后一帧（设置了 Boomerang 时为返回段的最后一帧）的延迟改为这个值，单位为百分之一秒，
+	// 使每次循环重新开始之前多停留一会儿。最后一段的 Hold 仍然加在它上面
+	LoopDelay int
+	// Transparent 为 true 时在调色板中保留一个透明色，帧中没有像素覆盖的格子保持透明，
+	// 而不是被量化为调色板中最接近黑色的颜色
+	Transparent bool
+	// Background 不为 nil 时把这个颜色加入调色板，并写入 GIF 的背景色索引，
+	// 使各个查看器用同一种颜色填充帧没有覆盖的区域。不能与 Transparent 同时使用
+	Background *color.RGBA
+	// Spool 为 true 时把转换好的帧暂存到临时目录，最后逐帧读回编码，内存中不再同时保存所有帧。
+	// 不能与 Boomerang 或 Trim 同时使用
+	Spool bool
+}
+
+// withTransparent 返回带有透明色的调色板及透明色的索引。调色板未满 256 色时追加透明色，
+// 否则用透明色替换最后一个颜色
+func withTransparent(p color.Palette) (color.Palette, int) {
+	out := make(color.Palette, len(p), 256)
+	copy(out, p)
+	if len(out) < 256 {
+		out = append(out, color.RGBA{})
+	} else {
+		out[len(out)-1] = color.RGBA{}
+	}
+	return out, len(out) - 1
+}
+
+// withColor 返回包含颜色 c 的调色板及 c 的索引。调色板中已有完全相同的颜色时直接使用它，
+// 否则与 withTransparent 一样追加或替换最后一个颜色
+func withColor(p color.Palette, c color.RGBA) (color.Palette, int) {
+	for i, pc := range p {
+		if toRGBA(pc) == c {
+			return p, i
+		}
+	}
+	out := make(color.Palette, len(p), 256)
+	copy(out, p)
+	if len(out) < 256 {
+		out = append(out, c)
+	} else {
+		out[len(out)-1] = c
+	}
+	return out, len(out) - 1
+}
+
+// invertPaletted 返回颜色反转后的帧。帧中的每个像素只引用调色板中的颜色，
+// 因此只需反转调色板即可得到新帧，像素数据与原帧共享
+func invertPaletted(frame *image.Paletted) *image.Paletted {
+	inverted := make(color.Palette, len(frame.Palette))
+	for i, c := range frame.Palette {
+		rgba := toRGBA(c)
+		inverted[i] = color.RGBA{rgba.A - rgba.R, rgba.A - rgba.G, rgba.A - rgba.B, rgba.A}
+	}
+	return &image.Paletted{
+		Pix:     frame.Pix,
+		Stride:  frame.Stride,
+		Rect:    frame.Rect,
+		Palette: inverted,
+	}
+}
+
+// appendBoomerang 在帧列表末尾追加倒序的返回段（不重复首尾两帧），使循环播放时能平滑回到第一帧。
+// invert 为 true 时返回段的帧会重新生成为颜色反转的版本
+func appendBoomerang(frames []*image.Paletted, delays []int, invert bool) ([]*image.Paletted, []int) {
+	for i := len(frames) - 2; i >= 1; i-- {
+		frame := frames[i]
+		if invert {
+			frame = invertPaletted(frame)
+		}
+		frames = append(frames, frame)
+		delays = append(delays, delays[i])
+	}
+	return frames, delays
+}
+
+// boomerangFrames 返回正向动画有 n 帧时加上返回段（见 appendBoomerang）后的总帧数 2n-2
+func boomerangFrames(n int) int {
+	return n + max(0, n-2)
+}
+
+// forwardFrameLimit 返回正向动画最多可以有多少帧，使加上返回段后总帧数不超过 maxFrames（至少为 2）。
+// 返回段使总帧数变为 2n-2，因此设置了 Boomerang 时正向动画最多 (maxFrames+2)/2 帧
+func forwardFrameLimit(maxFrames int, boomerang bool) int {
+	if !boomerang {
+		return maxFrames
+	}
+	return (maxFrames + 2) / 2
+}
+
+// samePaletted 判断两帧显示的内容是否完全相同（像素索引和调色板都相同）
+func samePaletted(a, b *image.Paletted) bool {
+	if a.Rect != b.Rect || a.Stride != b.Stride || len(a.Palette) != len(b.Palette) || !bytes.Equal(a.Pix, b.Pix) {
+		return false
+	}
+	for i := range a.Palette {
+		if toRGBA(a.Palette[i]) != toRGBA(b.Palette[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// trimFrames 把连续相同的帧合并为一帧，合并后的帧延迟为这些帧的延迟之和
+func trimFrames(frames []*image.Paletted, delays []int) ([]*image.Paletted, []int) {
+	var outFrames []*image.Paletted
+	var outDelays []int
+	for i, frame := range frames {
+		if last := len(outFrames) - 1; last >= 0 && samePaletted(outFrames[last], frame) {
+			outDelays[last] += delays[i]
+			continue
+		}
+		outFrames = append(outFrames, frame)
+		outDelays = append(outDelays, delays[i])
+	}
+	return outFrames, outDelays
+}
+
+// GIFResult 描述编码完成的 GIF 动画
+type GIFResult struct {
+	// Frames 是 GIF 中的帧数（包含倒序返回段，已合并相同的连续帧）
+	Frames int
+	// Width 和 Height 是输出帧的尺寸
+	Width, Height int
+	// TotalDelay 是所有帧的延迟之和，即播放一遍的时长，单位为百分之一秒
+	TotalDelay int
+	// Delays 是写入 GIF 的每一帧的延迟，单位为百分之一秒
+	Delays []int
+}
+
+// saveToFile 创建 outputPath，调用 encode 把内容写入其中再关闭文件。各个 SaveXxx 函数都是对应的
+// EncodeXxx（写入 io.Writer）加上这一层文件处理，因此写文件、写标准输出和写到内存都使用同一条编码路径。
+// 编码出错时返回编码的错误，否则返回关闭文件时的错误（例如磁盘已满导致缓冲的数据写入失败）
+func saveToFile(outputPath string, encode func(w io.Writer) error) error {
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("创建输出文件 %s 时出错: %w", outputPath, err)
+	}
+	if err := encode(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("写入输出文件 %s 时出错: %w", outputPath, err)
+	}
+	return nil
+}
+
+// SaveGIF 根据 AnimationPlan 生成并保存 GIF 动画（见 EncodeGIF）
+func SaveGIF(plan *AnimationPlan, outputPath string, delay int, opts GIFOptions) (GIFResult, error) {
+	log.Printf("正在生成 GIF 动画并编码到 %s...", outputPath)
+	var result GIFResult
+	err := saveToFile(outputPath, func(w io.Writer) (err error) {
+		result, err = EncodeGIF(w, plan, delay, opts)
+		return err
+	})
+	return result, err
+}
+
+// EncodeGIF 根据 AnimationPlan 生成 GIF 动画并写入 w
+func EncodeGIF(w io.Writer, plan *AnimationPlan, delay int, opts GIFOptions) (GIFResult, error) {
+	return encodeSegments(w, []gifSegment{{Plan: plan, Delay: delay}}, opts)
+}
 
-		// 将帧添加到 GIF
-		palettedFrame := image.NewPaletted(plan.Bounds, gifPalette)
-		draw.Draw(palettedFrame, palettedFrame.Bounds(), currentFrameRGBA, image.Point{}, draw.Src)
-		gifFrames = append(gifFrames, palettedFrame)
-		gifDelays = append(gifDelays, delay)
+// gifSegment 是 GIF 中由一个计划生成的一段动画
+type gifSegment struct {
+	Plan *AnimationPlan
+	// Delay 是这一段每一帧的延迟，单位为百分之一秒
+	Delay int
+	// Hold 是这一段最后一帧额外停留的时间，单位为百分之一秒
+	Hold int
+}
 
-		if frameCount%20 == 0 {
-			log.Printf("已生成 %d 帧...", frameCount)
+// encodeSegments 依次生成每一段动画的帧，编码为一个 GIF 写入 w。
+// 除第一段外，每一段都跳过重建的源图像帧，因为它与上一段的最后一帧相同
+func encodeSegments(w io.Writer, segments []gifSegment, opts GIFOptions) (GIFResult, error) {
+	samples := func() []*image.RGBA {
+		var samples []*image.RGBA
+		for _, seg := range segments {
+			samples = append(samples, renderStart(seg.Plan), renderTarget(seg.Plan))
+		}
+		return samples
+	}
+	return encodeFrames(w, samples, opts, func(sink *frameSink) error {
+		for i, seg := range segments {
+			frameOpts := opts.FrameOptions
+			if i > 0 {
+				frameOpts.SkipSource = true
+			}
+			if frameOpts.Progress == nil {
+				frameOpts.Progress = progressLogger()
+			}
+			_, err := RenderFrames(seg.Plan, frameOpts, func(frame *image.RGBA) {
+				sink.Add(frame, seg.Delay)
+			})
+			if err != nil {
+				return err
+			}
+			sink.Hold(seg.Hold)
 		}
+		return nil
+	})
+}
 
-		if allArrived {
-			log.Printf("所有像素已到达，总共生成 %d 帧。", frameCount)
-			break
+// progressLogger 返回按到达目标的像素比例记录渲染进度的 ProgressFunc，比例每跨过 10% 记录一次
+func progressLogger() ProgressFunc {
+	logged := -1
+	return func(arrived, total int) {
+		percent := 100
+		if total > 0 {
+			percent = arrived * 100 / total
+		}
+		if percent/10 > logged {
+			logged = percent / 10
+			log.Printf("已有 %d%% 的像素到达目标 (%d/%d)。", percent, arrived, total)
 		}
 	}
+}
 
-	outputFile, err := os.Create(outputPath)
+// frameSink 收集 encodeFrames 的帧生成函数产生的 RGBA 帧及其延迟
+type frameSink struct {
+	converter *frameConverter
+	outSize   OutputSize
+	delays    []int
+	// held 是 Hold 加在当前最后一帧上的时间
+	held int
+}
+
+// Add 把一帧交给转换器，在后台并行转换为调色板图像，delay 是这一帧的延迟（百分之一秒）
+func (s *frameSink) Add(frame *image.RGBA, delay int) {
+	s.converter.Add(s.outSize.Apply(frame))
+	s.delays = append(s.delays, delay)
+	s.held = 0
+	if len(s.delays)%20 == 0 {
+		log.Printf("已生成 %d 帧...", len(s.delays))
+	}
+}
+
+// Hold 把最后一帧的延迟增加 extra
+func (s *frameSink) Hold(extra int) {
+	if len(s.delays) > 0 {
+		s.delays[len(s.delays)-1] += extra
+		s.held += extra
+	}
+}
+
+// encodeFrames 按 opts 选择调色板，调用 generate 生成所有帧，再编码为一个 GIF 写入 w。
+// samples 返回计算精确调色板或自适应调色板时使用的代表帧，只在 opts.ExactPalette 或 opts.AdaptivePalette 为 true 时调用
+func encodeFrames(w io.Writer, samples func() []*image.RGBA, opts GIFOptions, generate func(sink *frameSink) error) (GIFResult, error) {
+	gifPalette := opts.Palette
+	exact := false
+	// Flash 把刚到达的像素混向白色，中间帧会出现首帧和末帧中没有的任意颜色，不能使用精确调色板。
+	// Jitter 只改变像素绘制的位置，不产生新的颜色
+	if opts.ExactPalette && opts.Lossy == 0 && !opts.Flash {
+		var extra []color.RGBA
+		if opts.DebugBackground == "checker" {
+			extra = append(extra, checkerMagenta)
+		}
+		// 透明色和背景色各需要占用一个位置
+		limit := maxPaletteSize
+		if opts.Transparent {
+			limit--
+		}
+		if opts.Background != nil {
+			limit--
+		}
+		if p := exactPalette(samples(), limit, extra...); p != nil {
+			log.Printf("动画只有 %d 种颜色，使用精确调色板，不做量化。", len(p))
+			gifPalette, exact = p, true
+		}
+	}
+	if opts.AdaptivePalette && !exact {
+		log.Println("正在根据首帧和末帧计算自适应调色板...")
+		gifPalette = buildAnimationPalette(samples())
+		log.Printf("自适应调色板包含 %d 种颜色。", len(gifPalette))
+	}
+	if gifPalette == nil {
+		gifPalette = palette.Plan9
+	}
+	dither := opts.Dither
+	if dither == nil {
+		dither = draw.Src
+	}
+	transparentIndex := -1
+	if opts.Transparent {
+		// 空格子在 RGBA 帧中是 (0,0,0,0)，量化时会精确匹配到透明色
+		gifPalette, transparentIndex = withTransparent(gifPalette)
+	}
+	backgroundIndex := -1
+	if opts.Background != nil {
+		if opts.Transparent {
+			return GIFResult{}, fmt.Errorf("a background color cannot be combined with a transparent GIF")
+		}
+		gifPalette, backgroundIndex = withColor(gifPalette, *opts.Background)
+	}
+
+	converter := newFrameConverter(gifPalette, dither, runtime.NumCPU())
+	converter.lossy = opts.Lossy
+	if opts.Spool {
+		if opts.Boomerang || opts.Trim {
+			return GIFResult{}, fmt.Errorf("spooling frames to disk cannot be combined with boomerang or trim")
+		}
+		spool, err := newFrameSpool()
+		if err != nil {
+			return GIFResult{}, err
+		}
+		// 无论成功还是出错都删除暂存的帧
+		defer spool.Close()
+		converter.spool = spool
+		log.Printf("正在把帧暂存到 %s...", spool.dir)
+	}
+	sink := &frameSink{converter: converter, outSize: opts.OutSize}
+
+	log.Println("正在生成动画帧...")
+	err := generate(sink)
+	gifFrames := converter.Wait()
 	if err != nil {
-		return fmt.Errorf("创建输出 GIF 文件 %s 时出错: %w", outputPath, err)
+		return GIFResult{}, err
+	}
+	if converter.spool != nil {
+		if err := converter.spool.Err(); err != nil {
+			return GIFResult{}, err
+		}
+	}
+	gifDelays := sink.delays
+	log.Printf("总共生成 %d 帧。", len(gifFrames))
+
+	if opts.Boomerang {
+		gifFrames, gifDelays = appendBoomerang(gifFrames, gifDelays, opts.InvertReturn)
+		log.Printf("已追加倒序返回段，共 %d 帧。", len(gifFrames))
+	}
+
+	if opts.LoopDelay > 0 && len(gifDelays) > 0 {
+		// 在合并相同的帧之前设置，合并后最后一帧的延迟仍然包含与它相同的前几帧的延迟
+		held := sink.held
+		if opts.Boomerang {
+			held = 0
+		}
+		gifDelays[len(gifDelays)-1] = opts.LoopDelay + held
+	}
+
+	if opts.Trim {
+		before := len(gifFrames)
+		gifFrames, gifDelays = trimFrames(gifFrames, gifDelays)
+		log.Printf("已合并相同的连续帧，帧数从 %d 减少到 %d。", before, len(gifFrames))
 	}
-	defer outputFile.Close()
 
 	g := &gif.GIF{
 		Image:     gifFrames,
 		Delay:     gifDelays,
 		LoopCount: 0, // 0 表示无限循环
 	}
+	if transparentIndex >= 0 || backgroundIndex >= 0 {
+		// 背景色索引只有在存在全局调色板时才会写入，因此需要显式设置 Config
+		g.Config = image.Config{
+			ColorModel: gifPalette,
+			Width:      gifFrames[0].Bounds().Dx(),
+			Height:     gifFrames[0].Bounds().Dy(),
+		}
+		g.BackgroundIndex = byte(max(transparentIndex, backgroundIndex))
+	}
+	if transparentIndex >= 0 {
+		// 每一帧显示完后恢复为背景（透明色），避免上一帧的像素残留在本帧的空格子中
+		g.Disposal = make([]byte, len(gifFrames))
+		for i := range g.Disposal {
+			g.Disposal[i] = gif.DisposalBackground
+		}
+	}
+	if converter.spool != nil {
+		err = encodeSpooledGIF(w, g, converter.spool)
+	} else {
+		err = gif.EncodeAll(w, g)
+	}
+	if err != nil {
+		return GIFResult{}, err
+	}
+	result := GIFResult{
+		Frames: len(gifFrames),
+		Width:  gifFrames[0].Bounds().Dx(),
+		Height: gifFrames[0].Bounds().Dy(),
+		Delays: gifDelays,
+	}
+	for _, d := range gifDelays {
+		result.TotalDelay += d
+	}
+	return result, nil
+}
 
-	log.Printf("正在将 GIF 动画编码到 %s...", outputPath)
-	return gif.EncodeAll(outputFile, g)
+// countingWriter 只统计写入的字节数，丢弃数据
+type countingWriter struct {
+	n int64
 }
 
-// SaveImage 根据 AnimationPlan 生成并保存最终的重排图像
-func SaveImage(plan *AnimationPlan, outputPath string) error {
-	log.Printf("正在生成最终的重排图像...")
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
 
-	finalImage := image.NewRGBA(plan.Bounds)
+// encodedGIFSize 按照 EncodeGIF 的方式编码动画并返回 GIF 的字节数，不保存任何文件
+func encodedGIFSize(plan *AnimationPlan, delay int, opts GIFOptions) (int64, error) {
+	var w countingWriter
+	if _, err := EncodeGIF(&w, plan, delay, opts); err != nil {
+		return 0, err
+	}
+	return w.n, nil
+}
+
+// renderStart 根据 AnimationPlan 中每个像素的起始位置重建源图像
+func renderStart(plan *AnimationPlan) *image.RGBA {
+	img := image.NewRGBA(plan.Bounds)
+	for _, ap := range plan.Pixels {
+		img.SetRGBA(ap.StartX, ap.StartY, ap.Color)
+	}
+	return expandBlocks(plan, img)
+}
 
+// renderTarget 根据 AnimationPlan 中每个像素的目标位置生成最终的重排图像，
+// 分块计划直接返回全分辨率的目标图像
+func renderTarget(plan *AnimationPlan) *image.RGBA {
+	if plan.BlockSize > 1 && plan.FullTarget != nil {
+		return fullTargetRGBA(plan)
+	}
+	img := image.NewRGBA(plan.Bounds)
 	for _, ap := range plan.Pixels {
 		// 在最后一帧，所有像素都应在其目标位置
-		finalImage.Set(ap.TargetX, ap.TargetY, ap.Color)
+		img.SetRGBA(ap.TargetX, ap.TargetY, ap.Color)
 	}
+	return img
+}
 
-	file, err := os.Create(outputPath)
+// savePNG 将图像以 PNG 格式写入指定路径
+func savePNG(img image.Image, outputPath string) error {
+	return saveToFile(outputPath, func(w io.Writer) error { return encodePNG(w, img) })
+}
+
+// encodePNG 把图像编码为 PNG。image.RGBA 以 8 位预乘 alpha 存储颜色，而 PNG 存储非预乘的颜色，
+// 半透明像素在两者之间转换时会损失精度（例如 alpha 为 2 的像素解码后颜色会变化）。
+// 因此图像中有半透明像素时改为以 16 位深度编码，解码后仍能得到与源像素完全相同的颜色和 alpha；
+// 只有完全透明和不透明像素时仍然使用 8 位深度
+func encodePNG(w io.Writer, img image.Image) error {
+	rgba, ok := img.(*image.RGBA)
+	if !ok || !hasPartialAlpha(rgba) {
+		return png.Encode(w, img)
+	}
+	deep := image.NewRGBA64(rgba.Bounds())
+	draw.Draw(deep, deep.Bounds(), rgba, rgba.Bounds().Min, draw.Src)
+	return png.Encode(w, deep)
+}
+
+// hasPartialAlpha 判断图像中是否有半透明（alpha 既不是 0 也不是 255）的像素
+func hasPartialAlpha(img *image.RGBA) bool {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(b.Min.X, y):img.PixOffset(b.Max.X, y)]
+		for i := 3; i < len(row); i += 4 {
+			if row[i] != 0 && row[i] != 0xFF {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ImageOptions 控制 SaveImage 的可选行为
+type ImageOptions struct {
+	// EXIF 是要写入 JPEG 输出的完整 EXIF APP1 段，为 nil 时不写入；输出为 PNG 时忽略
+	EXIF []byte
+	// OutSize 是输出图像的尺寸，重排按原始分辨率计算，编码前再缩放
+	OutSize OutputSize
+	// Recolor 不为 nil 时把最终图像的每个像素替换为其中最接近的颜色（见 recolorImage），在缩放之前执行
+	Recolor color.Palette
+}
+
+// imageFormat 根据输出文件的扩展名选择静态图片的格式："png"（.png 或没有扩展名）或 "jpeg"（.jpg、.jpeg）。
+// 其他扩展名返回包装了 ErrUnsupportedExtension 的错误
+func imageFormat(outputPath string) (string, error) {
+	switch ext := strings.ToLower(filepath.Ext(outputPath)); ext {
+	case "", ".png":
+		return "png", nil
+	case ".jpg", ".jpeg":
+		return "jpeg", nil
+	default:
+		return "", fmt.Errorf("%w: %q (use .png, .jpg or .jpeg)", ErrUnsupportedExtension, ext)
+	}
+}
+
+// SaveImage 根据 AnimationPlan 生成并保存最终的重排图像，格式由输出文件的扩展名决定（见 imageFormat 和 EncodeImage）
+func SaveImage(plan *AnimationPlan, outputPath string, opts ImageOptions) error {
+	format, err := imageFormat(outputPath)
 	if err != nil {
-		return fmt.Errorf("创建输出文件 %s 时出错: %w", outputPath, err)
+		return err
 	}
-	defer file.Close()
+	log.Printf("正在生成最终的重排图像并编码到 %s...", outputPath)
+	return saveToFile(outputPath, func(w io.Writer) error { return EncodeImage(w, plan, format, opts) })
+}
 
-	log.Printf("正在将图像编码到 %s...", outputPath)
-	// 根据文件扩展名选择编码器，默认为 PNG
-	ext := filepath.Ext(outputPath)
-	if ext == ".jpg" || ext == ".jpeg" {
-		// 可以为 JPEG 设置质量选项
-		return jpeg.Encode(file, finalImage, nil)
+// EncodeImage 根据 AnimationPlan 生成最终的重排图像，以 format（"png" 或 "jpeg"）格式写入 w
+func EncodeImage(w io.Writer, plan *AnimationPlan, format string, opts ImageOptions) error {
+	finalImage := renderTarget(plan)
+	if opts.Recolor != nil {
+		finalImage = recolorImage(finalImage, opts.Recolor)
+	}
+	finalImage = opts.OutSize.Apply(finalImage)
+	switch format {
+	case "png":
+		return encodePNG(w, finalImage)
+	case "jpeg":
+		if opts.EXIF == nil {
+			// 可以为 JPEG 设置质量选项
+			return jpeg.Encode(w, finalImage, nil)
+		}
+		// 先编码到内存，再把 EXIF 段插入到 SOI 之后
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, finalImage, nil); err != nil {
+			return err
+		}
+		_, err := w.Write(insertJPEGSegment(buf.Bytes(), opts.EXIF))
+		return err
+	default:
+		return fmt.Errorf("unsupported image format: %s", format)
+	}
+}
+
+// SaveEndpoints 只保存动画的首帧和末帧：prefix_start.png 由各像素的起始位置重建，
+// prefix_end.png 由各像素的目标位置重建，用于快速检查计划能否正确还原两张图像
+func SaveEndpoints(plan *AnimationPlan, prefix string) (startPath, endPath string, err error) {
+	startPath = prefix + "_start.png"
+	endPath = prefix + "_end.png"
+
+	log.Printf("正在将首帧保存到 %s...", startPath)
+	if err := savePNG(renderStart(plan), startPath); err != nil {
+		return "", "", err
+	}
+	log.Printf("正在将末帧保存到 %s...", endPath)
+	if err := savePNG(renderTarget(plan), endPath); err != nil {
+		return "", "", err
 	}
-	return png.Encode(file, finalImage)
+	return startPath, endPath, nil
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"runtime"
+	"testing"
+)
+
+// BenchmarkFrameConverter 比较 1 个 goroutine 和 runtime.NumCPU() 个 goroutine 把同一组（24 帧）RGBA 帧量化为 Plan9 调色板帧的耗时
+func BenchmarkFrameConverter(b *testing.B) {
+	plan := CreateAnimationPlan(benchImage(1), benchImage(2), PlanOptions{})
+	var frames []*image.RGBA
+	if _, err := RenderFrames(plan, FrameOptions{Motion: "deterministic"}, func(frame *image.RGBA) {
+		frames = append(frames, frame)
+	}); err != nil {
+		b.Fatal(err)
+	}
+	frames = frames[:min(len(frames), 24)]
+	for _, bc := range []struct {
+		name    string
+		workers int
+	}{
+		{"single", 1},
+		{fmt.Sprintf("numcpu=%d", runtime.NumCPU()), runtime.NumCPU()},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for b.Loop() {
+				c := newFrameConverter(palette.Plan9, draw.Src, bc.workers)
+				for _, frame := range frames {
+					// 转换器拥有提交的帧，转换后会交还给 framePool，因此每次提交一份副本
+					c.Add(toRGBAImage(frame))
+				}
+				c.Wait()
+			}
+		})
+	}
+}
+
+// TestBoomerangFrameLimit 检查设置 Boomerang 时按 forwardFrameLimit 限制正向动画后，加上返回段的 GIF 帧数不超过 maxFrames，
+// 并且 forwardFrameLimit 是满足条件的最大正向帧数
+func TestBoomerangFrameLimit(t *testing.T) {
+	for maxFrames := 2; maxFrames <= 12; maxFrames++ {
+		n := forwardFrameLimit(maxFrames, true)
+		if boomerangFrames(n) > maxFrames || boomerangFrames(n+1) <= maxFrames {
+			t.Errorf("maxFrames %d: forward limit %d gives %d frames and %d gives %d", maxFrames, n, boomerangFrames(n), n+1, boomerangFrames(n+1))
+		}
+	}
+
+	fx := fixturePairs()[3]
+	plan := CreateAnimationPlan(fx.Source, fx.Target, PlanOptions{})
+	for _, strategy := range []string{"speed", "skip"} {
+		for _, maxFrames := range []int{2, 3, 6, 11} {
+			opts, err := capFrameCount(plan, FrameOptions{Motion: "dither", Seed: 1}, forwardFrameLimit(maxFrames, true), strategy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := EncodeGIF(io.Discard, plan, 1, GIFOptions{FrameOptions: opts, Boomerang: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Frames > maxFrames {
+				t.Errorf("%s/%d: the boomerang GIF has %d frames", strategy, maxFrames, result.Frames)
+			}
+		}
+	}
+}
+
+// TestEncodeGIFSubImage 用原点不在 (0, 0) 的子图像编码 GIF：逻辑屏幕的尺寸是帧的 Dx()、Dy()，而不是 Bounds().Max，
+// 帧放在屏幕的原点，最后一帧与按计划渲染的结果相同（颜色少于 256 种，使用精确调色板）。设置 Transparent 时编码器使用显式的 Config
+func TestEncodeGIFSubImage(t *testing.T) {
+	r := image.Rect(5, 3, 19, 13)
+	fx := fixturePairs()[0]
+	src := fx.Source.(*image.RGBA).SubImage(r)
+	tgt := fx.Target.(*image.RGBA).SubImage(r)
+	plan := CreateAnimationPlan(src, tgt, PlanOptions{})
+	final := renderTarget(plan)
+	for _, transparent := range []bool{false, true} {
+		var buf bytes.Buffer
+		opts := GIFOptions{FrameOptions: FrameOptions{Motion: "line"}, ExactPalette: true, Transparent: transparent}
+		if _, err := EncodeGIF(&buf, plan, 1, opts); err != nil {
+			t.Fatalf("transparent %v: %v", transparent, err)
+		}
+		g, err := gif.DecodeAll(&buf)
+		if err != nil {
+			t.Fatalf("transparent %v: %v", transparent, err)
+		}
+		if g.Config.Width != r.Dx() || g.Config.Height != r.Dy() {
+			t.Errorf("transparent %v: the GIF screen is %dx%d, want %dx%d", transparent, g.Config.Width, g.Config.Height, r.Dx(), r.Dy())
+		}
+		last := g.Image[len(g.Image)-1]
+		if last.Rect != image.Rect(0, 0, r.Dx(), r.Dy()) {
+			t.Fatalf("transparent %v: the last frame covers %v, want the whole screen", transparent, last.Rect)
+		}
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if got, want := toRGBA(last.At(x-r.Min.X, y-r.Min.Y)), final.RGBAAt(x, y); got != want {
+					t.Fatalf("transparent %v: the last frame has %v at (%d,%d), want %v", transparent, got, x, y, want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// outputFields 是输出文件名模板中可以使用的字段
+type outputFields struct {
+	Name      string // 源图片的文件名（不含目录和扩展名）
+	Algorithm string // 使用的算法
+	Index     int    // 输出的序号，从 0 开始
+}
+
+// fieldMap 把字段转换为模板使用的小写键，配合 missingkey=error 在引用未知字段时报错
+func (f outputFields) fieldMap() map[string]any {
+	return map[string]any{"name": f.Name, "algorithm": f.Algorithm, "index": f.Index}
+}
+
+// parseOutputTemplate 解析 -outtpl 给出的文件名模板，例如 {{.name}}_{{.algorithm}}.gif。
+// 模板会先用示例数据执行一次，语法错误或引用了未知字段时在处理图片之前就返回错误
+func parseOutputTemplate(text string) (*template.Template, error) {
+	tpl, err := template.New("outtpl").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output template: %w", err)
+	}
+	if _, err := executeOutputTemplate(tpl, outputFields{Name: "source", Algorithm: "default"}); err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+// executeOutputTemplate 用给定的字段生成输出路径
+func executeOutputTemplate(tpl *template.Template, fields outputFields) (string, error) {
+	var sb strings.Builder
+	if err := tpl.Execute(&sb, fields.fieldMap()); err != nil {
+		return "", fmt.Errorf("invalid output template: %w", err)
+	}
+	if sb.Len() == 0 {
+		return "", fmt.Errorf("invalid output template: it produces an empty file name")
+	}
+	return sb.String(), nil
+}
+
+// baseName 返回路径的文件名部分，不含扩展名
+func baseName(path string) string {
+	name := filepath.Base(path)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
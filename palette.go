@@ -0,0 +1,238 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"sort"
+	"strings"
+)
+
+// maxPaletteSize 是 GIF 调色板允许的最大颜色数
+const maxPaletteSize = 256
+
+// colorCount 是直方图中的一种颜色及其出现次数
+type colorCount struct {
+	c     color.RGBA
+	count int
+}
+
+// colorBox 是中位切分算法中的一个颜色盒子
+type colorBox []colorCount
+
+// channel 返回颜色的第 i 个通道（0=R, 1=G, 2=B, 3=A）
+func channel(c color.RGBA, i int) uint8 {
+	switch i {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	case 2:
+		return c.B
+	}
+	return c.A
+}
+
+// widest 返回盒子中取值范围最大的通道及其范围
+func (b colorBox) widest() (int, int) {
+	best, bestRange := 0, -1
+	for i := 0; i < 4; i++ {
+		lo, hi := 255, 0
+		for _, cc := range b {
+			v := int(channel(cc.c, i))
+			lo, hi = min(lo, v), max(hi, v)
+		}
+		if hi-lo > bestRange {
+			best, bestRange = i, hi-lo
+		}
+	}
+	return best, bestRange
+}
+
+// average 返回盒子中所有颜色按出现次数加权的平均颜色
+func (b colorBox) average() color.RGBA {
+	var sum [4]int
+	total := 0
+	for _, cc := range b {
+		for i := 0; i < 4; i++ {
+			sum[i] += int(channel(cc.c, i)) * cc.count
+		}
+		total += cc.count
+	}
+	return color.RGBA{
+		uint8((sum[0] + total/2) / total),
+		uint8((sum[1] + total/2) / total),
+		uint8((sum[2] + total/2) / total),
+		uint8((sum[3] + total/2) / total),
+	}
+}
+
+// buildGlobalPalette 用中位切分算法从所有帧的颜色中计算一个最多 256 色的自适应调色板，
+// 所有帧共用这一个调色板，避免逐帧调色板带来的闪烁。颜色不超过 256 种时调色板精确包含所有颜色
+func buildGlobalPalette(frames []*image.RGBA) color.Palette {
+	return medianCut(frames, maxPaletteSize)
+}
+
+// buildAnimationPalette 计算动画所有帧共用的自适应调色板。像素在动画中只移动、不变色，首帧和末帧包含了所有像素的颜色，
+// 但中间帧还有没有像素覆盖的空格子 (0,0,0,0)，它们不在首帧和末帧中。因此中位切分只使用 255 个位置，
+// 另外保留不透明的黑色给空格子，与 Plan9 等调色板的表现相同；否则空格子会落到调色板中碰巧最接近的颜色上
+func buildAnimationPalette(frames []*image.RGBA) color.Palette {
+	p, _ := withColor(medianCut(frames, maxPaletteSize-1), color.RGBA{0, 0, 0, 0xFF})
+	return p
+}
+
+// medianCut 用中位切分算法从所有帧的颜色中计算最多 size 种颜色的调色板
+func medianCut(frames []*image.RGBA, size int) color.Palette {
+	histogram := map[color.RGBA]int{}
+	for _, frame := range frames {
+		for i := 0; i+3 < len(frame.Pix); i += 4 {
+			histogram[color.RGBA{frame.Pix[i], frame.Pix[i+1], frame.Pix[i+2], frame.Pix[i+3]}]++
+		}
+	}
+	all := make(colorBox, 0, len(histogram))
+	for c, n := range histogram {
+		all = append(all, colorCount{c, n})
+	}
+	if len(all) == 0 {
+		return padPalette(nil)
+	}
+
+	// 每次切分像素最多、且仍可切分的盒子，直到盒子数达到上限
+	boxes := []colorBox{all}
+	for len(boxes) < size {
+		split := -1
+		for i, b := range boxes {
+			if len(b) < 2 {
+				continue
+			}
+			if split < 0 || b.pixels() > boxes[split].pixels() {
+				split = i
+			}
+		}
+		if split < 0 {
+			break
+		}
+		b := boxes[split]
+		ch, _ := b.widest()
+		sort.Slice(b, func(i, j int) bool { return channel(b[i].c, ch) < channel(b[j].c, ch) })
+		// 在加权中位数处切分，两边至少各有一种颜色
+		half, acc, cut := b.pixels()/2, 0, 1
+		for i := range b[:len(b)-1] {
+			acc += b[i].count
+			if acc >= half {
+				cut = i + 1
+				break
+			}
+		}
+		boxes[split] = b[:cut]
+		boxes = append(boxes, b[cut:])
+	}
+
+	p := make(color.Palette, len(boxes))
+	for i, b := range boxes {
+		p[i] = b.average()
+	}
+	return padPalette(p)
+}
+
+// paletteFromImage 用中位切分算法从任意一张图像（例如一幅画作）计算最多 256 色的调色板，
+// 用于把动画的颜色限制在这张图像的色彩风格内
+func paletteFromImage(img image.Image) color.Palette {
+	return buildGlobalPalette([]*image.RGBA{toRGBAImage(img)})
+}
+
+// UniqueColors 返回图像中不同颜色（按 8 位预乘 RGBA 比较）的数量。重排只移动像素，动画的每一帧都由源图像的同一组像素组成，
+// 因此重排结果的颜色数就是调色板需要覆盖的颜色数：不超过 256 时可以无损地编码为 GIF，
+// 否则至少需要量化，可以据此在 plan9、adaptive 或更少的颜色之间选择
+func UniqueColors(img image.Image) int {
+	seen := make(map[color.RGBA]struct{})
+	if rgba, ok := img.(*image.RGBA); ok {
+		b := rgba.Rect
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				seen[rgba.RGBAAt(x, y)] = struct{}{}
+			}
+		}
+		return len(seen)
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			seen[toRGBA(img.At(x, y))] = struct{}{}
+		}
+	}
+	return len(seen)
+}
+
+// exactPalette 收集代表帧中的所有颜色，不超过 limit 种时把它们作为调色板返回（按颜色值排序，保证输出稳定），
+// 这样量化时每个像素都能精确匹配，GIF 与渲染的帧完全一致；颜色超过 limit 种或含有不透明度不为 255 的颜色时返回 nil。
+// 中间帧中没有像素覆盖的格子是 (0,0,0,0)，量化到 Plan9 等调色板时会落到不透明的黑色，因此这里也总是包含黑色，保持相同的表现。
+// extra 是只出现在中间帧中的其他颜色（例如 DebugBackground 的品红色），同样总是包含在调色板中
+func exactPalette(samples []*image.RGBA, limit int, extra ...color.RGBA) color.Palette {
+	black := color.RGBA{0, 0, 0, 0xFF}
+	seen := map[color.RGBA]struct{}{black: {}}
+	for _, c := range extra {
+		seen[c] = struct{}{}
+	}
+	for _, img := range samples {
+		b := img.Rect
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := img.RGBAAt(x, y)
+				if c.A != 0xFF {
+					return nil
+				}
+				seen[c] = struct{}{}
+			}
+		}
+		if len(seen) > limit {
+			return nil
+		}
+	}
+	colors := make([]color.RGBA, 0, len(seen))
+	for c := range seen {
+		colors = append(colors, c)
+	}
+	sort.Slice(colors, func(i, j int) bool {
+		a, b := colors[i], colors[j]
+		return uint32(a.R)<<16|uint32(a.G)<<8|uint32(a.B) < uint32(b.R)<<16|uint32(b.G)<<8|uint32(b.B)
+	})
+	p := make(color.Palette, len(colors))
+	for i, c := range colors {
+		p[i] = c
+	}
+	return padPalette(p)
+}
+
+// exactPaletteFor 判断 -palette 选择的调色板是否允许自动改用精确调色板：plan9 和 adaptive 只是通用的近似，
+// 颜色足够少时精确调色板严格更好；websafe、gray 等是用户有意选择的风格，保持不变
+func exactPaletteFor(name string) bool {
+	switch strings.ToLower(name) {
+	case "", "plan9", "adaptive":
+		return true
+	}
+	return false
+}
+
+// padPalette 保证调色板至少有 2 种颜色。纯色图像只能得到 1 种颜色，而只有 1 个条目的调色板
+// 在 GIF 中编码为 0 位的索引，部分解码器会显示错误或拒绝打开，因此补上与已有颜色反差最大的黑色或白色
+func padPalette(p color.Palette) color.Palette {
+	switch len(p) {
+	case 0:
+		return color.Palette{color.RGBA{0, 0, 0, 0xFF}, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}}
+	case 1:
+		if grayscaleOf(toRGBA(p[0])) < 128 {
+			return append(p, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF})
+		}
+		return append(p, color.RGBA{0, 0, 0, 0xFF})
+	}
+	return p
+}
+
+// pixels 返回盒子中的像素总数
+func (b colorBox) pixels() int {
+	n := 0
+	for _, cc := range b {
+		n += cc.count
+	}
+	return n
+}
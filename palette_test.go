@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+// decodedColorCount 用 opts 把从 source 到 target 的动画编码为 GIF，返回解码后所有帧中颜色为 c 的像素数
+func decodedColorCount(t *testing.T, source, target image.Image, opts GIFOptions, c color.RGBA) int {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := EncodeGIF(&buf, CreateAnimationPlan(source, target, PlanOptions{}), 1, opts); err != nil {
+		t.Fatal(err)
+	}
+	g, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, frame := range g.Image {
+		b := frame.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if toRGBA(frame.At(x, y)) == c {
+					n++
+				}
+			}
+		}
+	}
+	return n
+}
+
+// TestExactPaletteIntermediateColors 检查精确调色板不会吞掉只出现在中间帧中的颜色：
+// -debug-bg checker 的品红色和 -flash 的白色。两张图片都只有红色和蓝色，白色只能来自闪烁
+func TestExactPaletteIntermediateColors(t *testing.T) {
+	white := color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	red, blue := color.RGBA{0xC0, 0x20, 0x20, 0xFF}, color.RGBA{0x20, 0x20, 0xC0, 0xFF}
+	source := fixtureImage(func(x, y int) color.RGBA {
+		if (x/3+y/2)%2 == 0 {
+			return red
+		}
+		return blue
+	})
+	target := fixtureImage(func(x, y int) color.RGBA {
+		if (x/4+y/4)%2 == 0 {
+			return red
+		}
+		return blue
+	})
+	tests := []struct {
+		name  string
+		frame FrameOptions
+		color color.RGBA
+	}{
+		{"debug-bg", FrameOptions{Motion: "deterministic", DebugBackground: "checker"}, checkerMagenta},
+		{"flash", FrameOptions{Motion: "deterministic", Flash: true}, white},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exact := decodedColorCount(t, source, target, GIFOptions{FrameOptions: tt.frame, ExactPalette: true}, tt.color)
+			plain := decodedColorCount(t, source, target, GIFOptions{FrameOptions: tt.frame}, tt.color)
+			if plain == 0 {
+				t.Fatalf("the animation has no %v pixels even with the Plan9 palette", tt.color)
+			}
+			if exact == 0 {
+				t.Errorf("with the exact palette no pixel is %v; with Plan9 %d are", tt.color, plain)
+			}
+		})
+	}
+}
+
+// TestSolidAdaptivePalette 用纯色图片编码使用自适应调色板的 GIF，检查调色板被补足到至少 2 种颜色，
+// 并且结果能正常解码、最后一帧仍是原来的颜色
+func TestSolidAdaptivePalette(t *testing.T) {
+	c := color.RGBA{0x30, 0x90, 0xC0, 0xFF}
+	img := solidImage(image.Rect(0, 0, 8, 6), c)
+	plan := CreateAnimationPlan(img, img, PlanOptions{})
+	opts := GIFOptions{FrameOptions: FrameOptions{Motion: "deterministic"}, AdaptivePalette: true}
+	var buf bytes.Buffer
+	if _, err := EncodeGIF(&buf, plan, 1, opts); err != nil {
+		t.Fatal(err)
+	}
+	g, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := g.Image[len(g.Image)-1]
+	if len(last.Palette) < 2 {
+		t.Errorf("palette has %d colors, want at least 2", len(last.Palette))
+	}
+	if got := toRGBA(last.At(0, 0)); got != c {
+		t.Errorf("last frame color is %v, want %v", got, c)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// planFile 是 SavePlanJSON 写出的计划文件的内容
+type planFile struct {
+	// Bounds 是计划的范围：minX, minY, maxX, maxY
+	Bounds [4]int      `json:"bounds"`
+	Frames int         `json:"frames"`
+	Pixels []planPixel `json:"pixels"`
+}
+
+// planPixel 是计划文件中的一个像素：起点、终点和 RGBA 颜色
+type planPixel struct {
+	From  [2]int   `json:"from"`
+	To    [2]int   `json:"to"`
+	Color [4]uint8 `json:"rgba"`
+}
+
+// EncodePlanJSON 把计划以 JSON 格式写入 w。分块计划的 FullTarget 无法保存，因此不支持分块计划
+func EncodePlanJSON(w io.Writer, plan *AnimationPlan) error {
+	if plan.BlockSize > 1 {
+		return fmt.Errorf("block plans cannot be saved as JSON")
+	}
+	b := plan.Bounds
+	file := planFile{
+		Bounds: [4]int{b.Min.X, b.Min.Y, b.Max.X, b.Max.Y},
+		Frames: plan.Frames,
+		Pixels: make([]planPixel, len(plan.Pixels)),
+	}
+	for i, ap := range plan.Pixels {
+		file.Pixels[i] = planPixel{
+			From:  [2]int{ap.StartX, ap.StartY},
+			To:    [2]int{ap.TargetX, ap.TargetY},
+			Color: [4]uint8{ap.Color.R, ap.Color.G, ap.Color.B, ap.Color.A},
+		}
+	}
+	return json.NewEncoder(w).Encode(file)
+}
+
+// SavePlanJSON 把计划以 JSON 格式保存到 outputPath，之后可以用 LoadPlanJSON 读回
+func SavePlanJSON(plan *AnimationPlan, outputPath string) error {
+	return saveToFile(outputPath, func(w io.Writer) error { return EncodePlanJSON(w, plan) })
+}
+
+// LoadPlanJSON 读取 SavePlanJSON 保存的计划，并检查每个像素的起点和终点都在计划的范围内
+func LoadPlanJSON(path string) (*AnimationPlan, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plan file: %w", err)
+	}
+	defer f.Close()
+
+	var file planFile
+	if err := json.NewDecoder(f).Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to decode plan file %s: %w", path, err)
+	}
+	bounds := image.Rect(file.Bounds[0], file.Bounds[1], file.Bounds[2], file.Bounds[3])
+	if bounds.Empty() || file.Frames < 0 {
+		return nil, fmt.Errorf("invalid plan file %s: empty bounds or negative frame count", path)
+	}
+	plan := &AnimationPlan{Frames: file.Frames, Bounds: bounds, Pixels: make([]AnimationPixel, len(file.Pixels))}
+	for i, p := range file.Pixels {
+		from, to := image.Pt(p.From[0], p.From[1]), image.Pt(p.To[0], p.To[1])
+		if !from.In(bounds) || !to.In(bounds) {
+			return nil, fmt.Errorf("invalid plan file %s: pixel %d moves from %v to %v outside %v", path, i, from, to, bounds)
+		}
+		plan.Pixels[i] = AnimationPixel{
+			StartX:  from.X,
+			StartY:  from.Y,
+			TargetX: to.X,
+			TargetY: to.Y,
+			Color:   color.RGBA{p.Color[0], p.Color[1], p.Color[2], p.Color[3]},
+		}
+	}
+	return plan, nil
+}
+
+// planDiff 是两个计划中从同一起点出发的像素的终点之间的差别
+type planDiff struct {
+	// Matched 是两个计划中都有的起点数，Unmatched 是只出现在其中一个计划中的起点数
+	Matched   int
+	Unmatched int
+	// Changed 是终点不同的起点数，MaxShift 是两个终点之间最大的欧几里得距离
+	Changed  int
+	MaxShift float64
+	// Histogram 按终点之间的距离统计起点数：第 0 个区间是距离 0（终点相同），
+	// 第 i 个区间 (i >= 1) 是 [2^(i-1), 2^i)
+	Histogram []int
+}
+
+// diffPlans 按起点把两个计划中的像素对应起来，统计终点改变了多少、改变的距离如何分布。
+// 两个计划必须有相同的范围
+func diffPlans(a, b *AnimationPlan) (planDiff, error) {
+	if a.Bounds != b.Bounds {
+		return planDiff{}, fmt.Errorf("plans cover different areas: %v and %v", a.Bounds, b.Bounds)
+	}
+	bounds := a.Bounds
+	index := func(x, y int) int { return (y-bounds.Min.Y)*bounds.Dx() + x - bounds.Min.X }
+
+	// targets[i] 是计划 a 中从第 i 个位置出发的像素的终点，seen 记录计划 b 中出现过的起点
+	targets := make([]image.Point, bounds.Dx()*bounds.Dy())
+	inA := make([]bool, len(targets))
+	seen := make([]bool, len(targets))
+	for _, ap := range a.Pixels {
+		i := index(ap.StartX, ap.StartY)
+		targets[i], inA[i] = image.Pt(ap.TargetX, ap.TargetY), true
+	}
+
+	d := planDiff{Histogram: []int{0}}
+	for _, bp := range b.Pixels {
+		i := index(bp.StartX, bp.StartY)
+		seen[i] = true
+		if !inA[i] {
+			d.Unmatched++
+			continue
+		}
+		d.Matched++
+		shift := Euclidean(targets[i].X, targets[i].Y, bp.TargetX, bp.TargetY)
+		bucket := 0
+		if shift > 0 {
+			d.Changed++
+			d.MaxShift = max(d.MaxShift, shift)
+			bucket = 1 + int(math.Log2(shift))
+		}
+		for len(d.Histogram) <= bucket {
+			d.Histogram = append(d.Histogram, 0)
+		}
+		d.Histogram[bucket]++
+	}
+	for i := range inA {
+		if inA[i] && !seen[i] {
+			d.Unmatched++
+		}
+	}
+	return d, nil
+}
+
+// writePlanDiff 把 diffPlans 的结果以文本写入 w，直方图的每个区间画一条按比例缩放的条形
+func writePlanDiff(w io.Writer, d planDiff) {
+	fmt.Fprintf(w, "Matched pixels:   %d\n", d.Matched)
+	fmt.Fprintf(w, "Changed targets:  %d", d.Changed)
+	if d.Matched > 0 {
+		fmt.Fprintf(w, " (%.2f%%)", float64(d.Changed)*100/float64(d.Matched))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Unmatched starts: %d\n", d.Unmatched)
+	fmt.Fprintf(w, "Largest shift:    %.2f px\n", d.MaxShift)
+	fmt.Fprintln(w, "\nTarget shift histogram:")
+	largest := 0
+	for _, n := range d.Histogram {
+		largest = max(largest, n)
+	}
+	for i, n := range d.Histogram {
+		label := "0"
+		if i > 0 {
+			label = fmt.Sprintf("[%d,%d)", 1<<(i-1), 1<<i)
+		}
+		bar := 0
+		if largest > 0 {
+			bar = (n*40 + largest - 1) / largest
+		}
+		fmt.Fprintf(w, "  %-11s %8d %s\n", label, n, strings.Repeat("#", bar))
+	}
+}
@@ -0,0 +1,73 @@
+//go:build !(js && wasm)
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// stopProfiling 停止 main 开始的 profile 记录，见 startProfiling。exit 和 fatalf 在退出前调用它，
+// 因为 os.Exit 不会执行 main 中 defer 的函数，出错或超时退出时 profile 也能完整写入
+var stopProfiling = func() {}
+
+// exit 停止 profile 记录后以 code 退出进程，命令中需要退出时用它代替 os.Exit
+func exit(code int) {
+	stopProfiling()
+	os.Exit(code)
+}
+
+// fatalf 与 log.Fatalf 相同，但退出前先停止 profile 记录
+func fatalf(format string, v ...any) {
+	log.Printf(format, v...)
+	exit(1)
+}
+
+// startProfiling 在 cpuPath 不为空时开始记录 CPU profile，返回的 stop 函数停止记录，
+// 并在 memPath 不为空时写入堆内存 profile。两个路径都为空时 stop 什么也不做。
+// 用 go tool pprof 查看结果，例如 go tool pprof img2video cpu.prof
+func startProfiling(cpuPath, memPath string) (stop func(), err error) {
+	var cpuFile *os.File
+	if cpuPath != "" {
+		cpuFile, err = os.Create(cpuPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create CPU profile %s: %w", cpuPath, err)
+		}
+		if err := pprof.StartCPUProfile(cpuFile); err != nil {
+			cpuFile.Close()
+			return nil, fmt.Errorf("failed to start CPU profile: %w", err)
+		}
+	}
+
+	return func() {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			cpuFile.Close()
+			log.Printf("CPU profile saved to: %s", cpuPath)
+		}
+		if memPath != "" {
+			if err := writeHeapProfile(memPath); err != nil {
+				log.Printf("Error: %v", err)
+				return
+			}
+			log.Printf("Memory profile saved to: %s", memPath)
+		}
+	}, nil
+}
+
+// writeHeapProfile 先执行一次垃圾回收，使统计反映当前仍在使用的内存，再把堆 profile 写入 path
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create memory profile %s: %w", path, err)
+	}
+	defer f.Close()
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		return fmt.Errorf("failed to write memory profile: %w", err)
+	}
+	return nil
+}
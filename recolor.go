@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"strings"
+)
+
+// parseColorList 读取颜色列表：每行一个 #rgb、#rrggbb 或 #rrggbbaa 形式的颜色，
+// 空行和以 // 开头的注释行被忽略，颜色后面用空白隔开的内容（例如颜色的名称）也被忽略
+func parseColorList(r io.Reader) (color.Palette, error) {
+	var p color.Palette
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+		c, err := parseHexColor(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		p = append(p, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		return nil, fmt.Errorf("the color list is empty")
+	}
+	return p, nil
+}
+
+// readColorList 从文件中读取颜色列表（见 parseColorList）
+func readColorList(path string) (color.Palette, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	p, err := parseColorList(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// recolorImage 把图像的每个像素替换为 p 中在 RGB 空间里欧氏距离最近的颜色，得到海报化的效果。
+// 比较使用非预乘的颜色，像素原来的 alpha 保持不变，完全透明的像素不变
+func recolorImage(img *image.RGBA, p color.Palette) *image.RGBA {
+	entries := make([]color.NRGBA, len(p))
+	for i, c := range p {
+		entries[i] = color.NRGBAModel.Convert(c).(color.NRGBA)
+	}
+	// 照片通常也只有几万种颜色，缓存每种颜色的结果避免重复搜索
+	cache := make(map[color.RGBA]color.RGBA)
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			if c.A == 0 {
+				continue
+			}
+			snapped, ok := cache[c]
+			if !ok {
+				n := color.NRGBAModel.Convert(c).(color.NRGBA)
+				best, bestDist := entries[0], -1
+				for _, e := range entries {
+					dr, dg, db := int(n.R)-int(e.R), int(n.G)-int(e.G), int(n.B)-int(e.B)
+					if d := dr*dr + dg*dg + db*db; bestDist < 0 || d < bestDist {
+						best, bestDist = e, d
+					}
+				}
+				snapped = toRGBA(color.NRGBA{best.R, best.G, best.B, c.A})
+				cache[c] = snapped
+			}
+			dst.SetRGBA(x, y, snapped)
+		}
+	}
+	return dst
+}
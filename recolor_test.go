@@ -0,0 +1,39 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// TestRecolorImage 用一个已知的小颜色列表检查 -recolor：解析注释和颜色名，每个像素替换为 RGB 距离最近的颜色，
+// 半透明像素保留原来的 alpha，完全透明的像素不变
+func TestRecolorImage(t *testing.T) {
+	colors, err := parseColorList(strings.NewReader("// primaries\n#f00 red\n\n#00ff00\n#0000ffff blue\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(colors) != 3 {
+		t.Fatalf("parsed %d colors, want 3", len(colors))
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	img.SetRGBA(0, 0, color.RGBA{0xC0, 0x30, 0x20, 0xFF})
+	img.SetRGBA(1, 0, color.RGBA{0x40, 0x90, 0x70, 0xFF})
+	img.SetRGBA(2, 0, color.RGBA{0x10, 0x20, 0x40, 0x80})
+	recolored := recolorImage(img, colors)
+	for x, want := range []color.RGBA{{0xFF, 0, 0, 0xFF}, {0, 0xFF, 0, 0xFF}, {0, 0, 0x80, 0x80}, {}} {
+		if got := recolored.RGBAAt(x, 0); got != want {
+			t.Errorf("pixel %d recolored to %v, want %v", x, got, want)
+		}
+	}
+}
+
+// TestParseColorListInvalid 检查颜色列表中无法解析的颜色会报错
+func TestParseColorListInvalid(t *testing.T) {
+	for _, list := range []string{"#12345\n", "red\n", "#gg0000\n"} {
+		if _, err := parseColorList(strings.NewReader(list)); err == nil {
+			t.Errorf("%q was accepted", list)
+		}
+	}
+}
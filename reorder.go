@@ -1,9 +1,12 @@
 package main
 
 import (
+	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
+	"iter"
+	"log"
 	"sort"
 )
 
@@ -15,6 +18,15 @@ type Pixel struct {
 	Color          color.RGBA
 }
 
+// grayOrder 返回按 data 的比较排序时使用的顺序：descending 为 true 时（PlanOptions.Descending）整体反过来，
+// 像素按灰度从亮到暗排序。Pixels、PixelsFeatured 和 PixelsByEdge 都通过它排序
+func grayOrder(data sort.Interface, descending bool) sort.Interface {
+	if descending {
+		return sort.Reverse(data)
+	}
+	return data
+}
+
 // Pixels 是 Pixel 结构体的切片，用于实现 sort.Interface 接口（复杂排序）
 type Pixels []Pixel
 
@@ -64,25 +76,85 @@ type AnimationPlan struct {
 	Pixels []AnimationPixel
 	Frames int
 	Bounds image.Rectangle
+
+	// BlockSize 大于 1 时，Pixels 中的每个元素代表原图中 BlockSize x BlockSize 的像素块，
+	// Pixels 和 Bounds 的坐标都以块为单位，渲染时放大为全分辨率
+	BlockSize int
+	// FullTarget 是分块计划的全分辨率目标图像，用作动画的最后一帧
+	FullTarget image.Image
+	// Descending 记录计划是否按灰度从亮到暗排序（PlanOptions.Descending），wave 运动据此决定像素出发的顺序
+	Descending bool
+}
+
+// Clone 返回计划的深拷贝，修改副本的 Pixels 不会影响原计划（FullTarget 图像只读，因此共享）
+func (plan *AnimationPlan) Clone() *AnimationPlan {
+	clone := *plan
+	clone.Pixels = make([]AnimationPixel, len(plan.Pixels))
+	copy(clone.Pixels, plan.Pixels)
+	return &clone
+}
+
+// Reverse 返回一个新的计划，其中每个像素的起点和终点互换，即从重排结果变回源图像。
+// 反转两次得到与原计划相同的计划。分块计划没有全分辨率的源图像，因此反转后 FullTarget 为 nil，
+// 以块分辨率渲染
+func (plan *AnimationPlan) Reverse() *AnimationPlan {
+	reversed := plan.Clone()
+	for i := range reversed.Pixels {
+		p := &reversed.Pixels[i]
+		p.StartX, p.TargetX = p.TargetX, p.StartX
+		p.StartY, p.TargetY = p.TargetY, p.StartY
+	}
+	reversed.FullTarget = nil
+	return reversed
+}
+
+// toRGBA 将任意颜色转换为 8 位精度的 color.RGBA（alpha 预乘）
+func toRGBA(c color.Color) color.RGBA {
+	r, g, b, a := c.RGBA()
+	return color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
+}
+
+// grayscaleOf 计算颜色的灰度值。
+//
+// alpha 策略：color.RGBA 的分量已经按 alpha 预乘，因此得到的灰度等于颜色在不透明时的灰度乘以 alpha/255，
+// 也就是把像素叠加到黑色背景上的亮度，完全透明的像素灰度为 0。imageToPixels 和 CalculateGrayscaleSum
+// 都通过此函数计算灰度，保证两者的结果一致。
+func grayscaleOf(c color.RGBA) float64 {
+	return float64(c.R)*0.299 + float64(c.G)*0.587 + float64(c.B)*0.114
+}
+
+// imagePixels 返回按行遍历图像所有像素的迭代器，逐个产生 Pixel 而不分配整个切片，
+// 适合只需要流式处理像素的场景（例如计算灰度总和）。图像实现了 pixelMask 时只产生被保留的像素
+func imagePixels(img image.Image) iter.Seq[Pixel] {
+	return func(yield func(Pixel) bool) {
+		mask, _ := img.(pixelMask)
+		bounds := img.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if mask != nil && !mask.Keep(x, y) {
+					continue
+				}
+				c := toRGBA(img.At(x, y))
+				p := Pixel{
+					GrayscaleValue: grayscaleOf(c),
+					OriginalX:      x,
+					OriginalY:      y,
+					Color:          c,
+				}
+				if !yield(p) {
+					return
+				}
+			}
+		}
+	}
 }
 
 // imageToPixels 将 image.Image 转换为 Pixel 列表，并计算灰度值
 func imageToPixels(img image.Image) []Pixel {
 	bounds := img.Bounds()
 	pixels := make([]Pixel, 0, bounds.Dx()*bounds.Dy())
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			originalColor := img.At(x, y)
-			r, g, b, a := originalColor.RGBA()
-			c := color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
-			grayscale := float64(c.R)*0.299 + float64(c.G)*0.587 + float64(c.B)*0.114
-			pixels = append(pixels, Pixel{
-				GrayscaleValue: grayscale,
-				OriginalX:      x,
-				OriginalY:      y,
-				Color:          c,
-			})
-		}
+	for p := range imagePixels(img) {
+		pixels = append(pixels, p)
 	}
 	return pixels
 }
@@ -114,12 +186,46 @@ func calculatePlan(sourcePixels []Pixel, targetPixels []PixelFeatured, bounds im
 	}
 }
 
+// checkPixelCount 检查 imageToPixels 为图像产生的像素数恰好等于图像的像素数，
+// 保证计划是源像素和目标位置之间的一一对应。实现了 pixelMask 的图像有意只产生部分像素，不做检查
+func checkPixelCount(img image.Image, pixels []Pixel) error {
+	if _, ok := img.(pixelMask); ok {
+		return nil
+	}
+	bounds := img.Bounds()
+	if want := bounds.Dx() * bounds.Dy(); len(pixels) != want {
+		return fmt.Errorf("pixel list has %d pixels, but the %dx%d image has %d", len(pixels), bounds.Dx(), bounds.Dy(), want)
+	}
+	return nil
+}
+
+// checkPlanPixelCount 检查计划中的像素数恰好等于图像的像素数，即每个源像素都有一个目标位置。
+// 与 checkPixelCount 一样，实现了 pixelMask 的图像有意只产生部分像素，不做检查
+func checkPlanPixelCount(img image.Image, plan *AnimationPlan) error {
+	if _, ok := img.(pixelMask); ok {
+		return nil
+	}
+	bounds := img.Bounds()
+	if want := bounds.Dx() * bounds.Dy(); len(plan.Pixels) != want {
+		return fmt.Errorf("plan has %d pixels, but the %dx%d image has %d", len(plan.Pixels), bounds.Dx(), bounds.Dy(), want)
+	}
+	return nil
+}
+
 // CreateAnimationPlan 计算源图像到目标图像的像素移动路径（默认复杂排序）
-func CreateAnimationPlan(sourceImg, targetImg image.Image) *AnimationPlan {
+func CreateAnimationPlan(sourceImg, targetImg image.Image, opts PlanOptions) *AnimationPlan {
 	sourcePixels := imageToPixels(sourceImg)
 	targetPixels := imageToPixels(targetImg)
-	sort.Sort(Pixels(sourcePixels))
-	sort.Sort(Pixels(targetPixels))
+	// 像素数不对说明 imageToPixels 跳过或重复了像素，是程序的错误。这里只记录下来，
+	// createPlan 会用 checkPlanPixelCount 检查得到的计划并返回错误
+	if err := checkPixelCount(sourceImg, sourcePixels); err != nil {
+		log.Printf("源图像的像素列表有误: %v", err)
+	}
+	if err := checkPixelCount(targetImg, targetPixels); err != nil {
+		log.Printf("目标图像的像素列表有误: %v", err)
+	}
+	sort.Sort(grayOrder(Pixels(sourcePixels), opts.Descending))
+	sort.Sort(grayOrder(Pixels(targetPixels), opts.Descending))
 
 	// 将 targetPixels 转换为 PixelFeatured 以匹配 calculatePlan 的签名
 	targetPixelsFeatured := make([]PixelFeatured, len(targetPixels))
@@ -130,73 +236,116 @@ func CreateAnimationPlan(sourceImg, targetImg image.Image) *AnimationPlan {
 }
 
 // CreateAnimationPlanFeatured 使用特征排序计算动画计划
-func CreateAnimationPlanFeatured(sourceImg, targetImg image.Image) *AnimationPlan {
+func CreateAnimationPlanFeatured(sourceImg, targetImg image.Image, opts PlanOptions) *AnimationPlan {
 	sourcePixels := imageToPixels(sourceImg)
 	targetPixelsRaw := imageToPixels(targetImg)
 
 	// 1. 对源图使用默认复杂排序
-	sort.Sort(Pixels(sourcePixels))
+	sort.Sort(grayOrder(Pixels(sourcePixels), opts.Descending))
 
 	// 2. 对目标图使用特征排序
 	// 2a. 预计算灰度网格以便快速查找
 	bounds := targetImg.Bounds()
-	// 先将目标图转为灰度图
-	grayImg := image.NewGray(bounds)
-	draw.Draw(grayImg, bounds, targetImg, bounds.Min, draw.Src)
-
-	grayGrid := make([][]float64, bounds.Max.Y)
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		grayGrid[y] = make([]float64, bounds.Max.X)
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			// 从灰度图中安全地读取灰度值
-			grayGrid[y][x] = float64(grayImg.GrayAt(x, y).Y)
-		}
-	}
+	grayGrid := buildGrayGrid(targetImg)
+	visible := buildVisibleGrid(targetImg, depthMinAlpha)
 
 	// 2b. 计算每个目标像素的区间深度
 	targetPixelsFeatured := make([]PixelFeatured, len(targetPixelsRaw))
 	for i, p := range targetPixelsRaw {
-		depth := calculateIntervalDepth(p.OriginalX, p.OriginalY, grayGrid, bounds)
+		depth := calculateIntervalDepth(p.OriginalX, p.OriginalY, grayGrid, visible, bounds)
 		targetPixelsFeatured[i] = PixelFeatured{Pixel: p, IntervalDepth: depth}
 	}
 
 	// 2c. 对目标像素进行特征排序
-	sort.Sort(PixelsFeatured(targetPixelsFeatured))
+	sort.Sort(grayOrder(PixelsFeatured(targetPixelsFeatured), opts.Descending))
 
 	return calculatePlan(sourcePixels, targetPixelsFeatured, sourceImg.Bounds())
 }
 
-// calculateIntervalDepth 计算给定坐标的像素的区间深度
-func calculateIntervalDepth(x, y int, grayGrid [][]float64, bounds image.Rectangle) float64 {
-	avg3x3 := calculateAverageGray(x, y, 1, grayGrid, bounds) // 3x3 区域半径为 1
-	avg5x5 := calculateAverageGray(x, y, 2, grayGrid, bounds) // 5x5 区域半径为 2
+// buildGrayGrid 将图像转为灰度图，并返回灰度网格。
+// 网格的坐标相对于 bounds.Min：图像中 (x, y) 处的灰度保存在 grayGrid[y-bounds.Min.Y][x-bounds.Min.X]，
+// 因此即使是原点不在 (0, 0) 的子图像，网格也只占用 Dx()*Dy() 的空间
+func buildGrayGrid(img image.Image) [][]float64 {
+	bounds := img.Bounds()
+	// 先将图像转为灰度图
+	grayImg := image.NewGray(bounds)
+	draw.Draw(grayImg, bounds, img, bounds.Min, draw.Src)
+
+	grayGrid := make([][]float64, bounds.Dy())
+	for y := range grayGrid {
+		grayGrid[y] = make([]float64, bounds.Dx())
+		for x := range grayGrid[y] {
+			// 从灰度图中安全地读取灰度值
+			grayGrid[y][x] = float64(grayImg.GrayAt(bounds.Min.X+x, bounds.Min.Y+y).Y)
+		}
+	}
+	return grayGrid
+}
+
+// depthMinAlpha 是计算区间深度时参与平均的格子的最小 alpha。透明的格子在灰度网格中接近黑色，
+// 但它并不是图像中可见的暗部，计入平均会把透明区域边缘的像素都算成处在暗的区间中
+const depthMinAlpha = 128
+
+// buildVisibleGrid 返回与 buildGrayGrid 坐标一致的网格，标记 alpha 不小于 minAlpha 的格子。
+// 图像中所有像素都满足条件时（例如不透明的图像）返回 nil，表示每个格子都参与平均
+func buildVisibleGrid(img image.Image, minAlpha uint8) [][]bool {
+	bounds := img.Bounds()
+	visible := make([][]bool, bounds.Dy())
+	all := true
+	for y := range visible {
+		visible[y] = make([]bool, bounds.Dx())
+		for x := range visible[y] {
+			visible[y][x] = toRGBA(img.At(bounds.Min.X+x, bounds.Min.Y+y)).A >= minAlpha
+			all = all && visible[y][x]
+		}
+	}
+	if all {
+		return nil
+	}
+	return visible
+}
+
+// calculateIntervalDepth 计算给定坐标（图像坐标，非网格坐标）的像素的区间深度，
+// visible 不为 nil 时只有其中标记的格子参与平均（见 buildVisibleGrid）
+func calculateIntervalDepth(x, y int, grayGrid [][]float64, visible [][]bool, bounds image.Rectangle) float64 {
+	avg3x3 := calculateAverageGray(x, y, 1, grayGrid, visible, bounds) // 3x3 区域半径为 1
+	avg5x5 := calculateAverageGray(x, y, 2, grayGrid, visible, bounds) // 5x5 区域半径为 2
 	return avg5x5*0.25 + avg3x3*0.75
 }
 
-// CalculateGrayscaleSum 计算并返回图像所有像素的灰度值总和
+// CalculateGrayscaleSum 计算并返回图像所有像素的灰度值总和（按 alpha 加权，见 grayscaleOf）
 func CalculateGrayscaleSum(img image.Image) float64 {
 	var sum float64
-	bounds := img.Bounds()
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			r, g, b, _ := img.At(x, y).RGBA()
-			// 使用与 imageToPixels 中相同的亮度计算公式
-			grayscale := float64(uint8(r>>8))*0.299 + float64(uint8(g>>8))*0.587 + float64(uint8(b>>8))*0.114
-			sum += grayscale
-		}
+	// 使用与 imageToPixels 中相同的迭代器和亮度计算公式，不分配像素切片
+	for p := range imagePixels(img) {
+		sum += p.GrayscaleValue
+	}
+	return sum
+}
+
+// PlanGrayscaleSum 直接从 plan.Pixels 计算重排结果的灰度总和，不需要先生成图像。
+// 重排只改变像素的位置、不改变颜色，因此结果应与源图像的 CalculateGrayscaleSum 相同
+func PlanGrayscaleSum(plan *AnimationPlan) float64 {
+	var sum float64
+	for _, ap := range plan.Pixels {
+		sum += grayscaleOf(ap.Color)
 	}
 	return sum
 }
 
-// calculateAverageGray 计算以 (cx, cy) 为中心，半径为 radius 的区域的平均灰度值
-func calculateAverageGray(cx, cy, radius int, grayGrid [][]float64, bounds image.Rectangle) float64 {
+// calculateAverageGray 计算以 (cx, cy) 为中心，半径为 radius 的区域的平均灰度值。
+// visible 不为 nil 时跳过其中没有标记的（透明的）格子，区域中没有可见的格子时返回 0
+func calculateAverageGray(cx, cy, radius int, grayGrid [][]float64, visible [][]bool, bounds image.Rectangle) float64 {
 	var sum float64
 	var count int
 	for y := cy - radius; y <= cy+radius; y++ {
 		for x := cx - radius; x <= cx+radius; x++ {
-			// 确保坐标在图像边界内
+			// 确保坐标在图像边界内，网格坐标相对于 bounds.Min
 			if x >= bounds.Min.X && x < bounds.Max.X && y >= bounds.Min.Y && y < bounds.Max.Y {
-				sum += grayGrid[y][x]
+				if visible != nil && !visible[y-bounds.Min.Y][x-bounds.Min.X] {
+					continue
+				}
+				sum += grayGrid[y-bounds.Min.Y][x-bounds.Min.X]
 				count++
 			}
 		}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+	"testing"
+)
+
+// TestCreatePlanChecksPixelCount 检查 createPlan 对每种注册的算法都检查计划的像素数：
+// 正常的算法都能通过，漏掉一个像素的算法得到错误，而不是 panic 或把错误的计划交给渲染
+func TestCreatePlanChecksPixelCount(t *testing.T) {
+	fx := fixturePairs()[0]
+	for _, name := range algorithmNames() {
+		if _, err := createPlan(name, fx.Source, fx.Target, PlanOptions{}); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	RegisterAlgorithm("droppixel", "drops the last pixel of the default plan", func(src, tgt image.Image, opts PlanOptions) *AnimationPlan {
+		plan := CreateAnimationPlan(src, tgt, opts)
+		plan.Pixels = plan.Pixels[:len(plan.Pixels)-1]
+		return plan
+	})
+	defer delete(algorithms, "droppixel")
+	_, err := createPlan("droppixel", fx.Source, fx.Target, PlanOptions{})
+	if err == nil || !strings.Contains(err.Error(), "invalid plan") {
+		t.Errorf("a plan missing a pixel gave error %v, want an invalid plan error", err)
+	}
+}
+
+// BenchmarkGrayscaleSum 比较 CalculateGrayscaleSum 直接遍历 imagePixels 与先用 imageToPixels 生成像素切片再求和的分配
+func BenchmarkGrayscaleSum(b *testing.B) {
+	img := benchImage(1)
+	b.Run("iterator", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			CalculateGrayscaleSum(img)
+		}
+	})
+	b.Run("slice", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			var sum float64
+			for _, p := range imageToPixels(img) {
+				sum += p.GrayscaleValue
+			}
+		}
+	})
+}
+
+// TestGrayscaleSumAlpha 用半透明的 NRGBA 图像检查 imageToPixels、CalculateGrayscaleSum 和 PlanGrayscaleSum 使用相同的 alpha 加权：
+// 每个像素的灰度约等于不透明时的灰度乘以 alpha/255（预乘的舍入误差在 1 以内），完全透明的像素为 0，三个总和完全相同
+func TestGrayscaleSumAlpha(t *testing.T) {
+	b := image.Rect(0, 0, 4, 3)
+	img := image.NewNRGBA(b)
+	alphas := []uint8{0xFF, 0xC0, 0x80, 0x40, 0x01, 0x00}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{200, uint8(40 * x), uint8(60 * y), alphas[(x+y*b.Dx())%len(alphas)]})
+		}
+	}
+
+	var pixelSum float64
+	for _, p := range imageToPixels(img) {
+		c := img.NRGBAAt(p.OriginalX, p.OriginalY)
+		opaque := grayscaleOf(color.RGBA{c.R, c.G, c.B, 0xFF})
+		if want := opaque * float64(c.A) / 0xFF; math.Abs(p.GrayscaleValue-want) > 1 {
+			t.Errorf("pixel (%d,%d) with alpha %d has grayscale %.3f, want about %.3f", p.OriginalX, p.OriginalY, c.A, p.GrayscaleValue, want)
+		}
+		if c.A == 0 && p.GrayscaleValue != 0 {
+			t.Errorf("transparent pixel (%d,%d) has grayscale %.3f", p.OriginalX, p.OriginalY, p.GrayscaleValue)
+		}
+		pixelSum += p.GrayscaleValue
+	}
+	if sum := CalculateGrayscaleSum(img); sum != pixelSum {
+		t.Errorf("CalculateGrayscaleSum = %f, imageToPixels sums to %f", sum, pixelSum)
+	}
+	if sum := PlanGrayscaleSum(CreateAnimationPlan(img, img, PlanOptions{})); math.Abs(sum-pixelSum) > 1e-9 {
+		t.Errorf("PlanGrayscaleSum = %f, imageToPixels sums to %f", sum, pixelSum)
+	}
+}
+
+// TestIntervalDepth 用一个手工计算过结果的 5x5 灰度网格检查 featured 算法的区域平均和区间深度，
+// 覆盖中心、边和角上的像素，确认 3x3/5x5 区域在边界处只统计图像内的格子。
+// 网格的值为 5*行+列，bounds 故意不从原点开始，以检查图像坐标到网格坐标的换算
+func TestIntervalDepth(t *testing.T) {
+	bounds := image.Rect(10, 20, 15, 25)
+	grid := make([][]float64, 5)
+	for y := range grid {
+		grid[y] = make([]float64, 5)
+		for x := range grid[y] {
+			grid[y][x] = float64(5*y + x)
+		}
+	}
+	for _, tc := range []struct {
+		name              string
+		x, y              int // 网格坐标
+		avg3, avg5, depth float64
+	}{
+		{"center", 2, 2, 12, 12, 12},
+		{"top edge", 2, 0, 4.5, 7, 5.125},
+		{"top-left corner", 0, 0, 3, 6, 3.75},
+		{"bottom-right corner", 4, 4, 21, 18, 20.25},
+	} {
+		x, y := bounds.Min.X+tc.x, bounds.Min.Y+tc.y
+		if got := calculateAverageGray(x, y, 1, grid, nil, bounds); got != tc.avg3 {
+			t.Errorf("%s: 3x3 average = %v, want %v", tc.name, got, tc.avg3)
+		}
+		if got := calculateAverageGray(x, y, 2, grid, nil, bounds); got != tc.avg5 {
+			t.Errorf("%s: 5x5 average = %v, want %v", tc.name, got, tc.avg5)
+		}
+		if got := calculateIntervalDepth(x, y, grid, nil, bounds); got != tc.depth {
+			t.Errorf("%s: depth = %v, want %v", tc.name, got, tc.depth)
+		}
+	}
+}
+
+// TestFeaturedSubImage 用原点不在 (0, 0) 的子图像检查 featured 算法：灰度网格只覆盖子图像，
+// 每个像素的区间深度与把子图像复制到原点后的结果相同（子图像外的邻居不参与平均），
+// 计划的范围是子图像的范围，并且与原点处副本的计划只差一个平移
+func TestFeaturedSubImage(t *testing.T) {
+	r := image.Rect(7, 5, 21, 14)
+	src := noiseImage(3).SubImage(r)
+	tgt := sceneImage(4).SubImage(r)
+	atOrigin := func(img image.Image) *image.RGBA {
+		dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+		draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+		return dst
+	}
+	src0, tgt0 := atOrigin(src), atOrigin(tgt)
+
+	grid, grid0 := buildGrayGrid(tgt), buildGrayGrid(tgt0)
+	if len(grid) != r.Dy() || len(grid[0]) != r.Dx() {
+		t.Fatalf("gray grid is %dx%d, want %dx%d", len(grid[0]), len(grid), r.Dx(), r.Dy())
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			gx, gy := x-r.Min.X, y-r.Min.Y
+			if grid[gy][gx] != grid0[gy][gx] {
+				t.Fatalf("gray grid at (%d,%d) is %v, the copy at the origin has %v", x, y, grid[gy][gx], grid0[gy][gx])
+			}
+			depth := calculateIntervalDepth(x, y, grid, nil, r)
+			depth0 := calculateIntervalDepth(gx, gy, grid0, nil, tgt0.Bounds())
+			if depth != depth0 {
+				t.Errorf("depth at (%d,%d) is %v, the copy at the origin has %v", x, y, depth, depth0)
+			}
+		}
+	}
+
+	plan := CreateAnimationPlanFeatured(src, tgt, PlanOptions{})
+	if err := checkPlanInvariants(plan, src); err != nil {
+		t.Fatal(err)
+	}
+	plan0 := CreateAnimationPlanFeatured(src0, tgt0, PlanOptions{})
+	if plan.Frames != plan0.Frames || len(plan.Pixels) != len(plan0.Pixels) {
+		t.Fatalf("plan has %d frames and %d pixels, the copy at the origin has %d and %d",
+			plan.Frames, len(plan.Pixels), plan0.Frames, len(plan0.Pixels))
+	}
+	for i, ap := range plan.Pixels {
+		ap0 := plan0.Pixels[i]
+		ap0.StartX, ap0.StartY = ap0.StartX+r.Min.X, ap0.StartY+r.Min.Y
+		ap0.TargetX, ap0.TargetY = ap0.TargetX+r.Min.X, ap0.TargetY+r.Min.Y
+		if ap != ap0 {
+			t.Fatalf("pixel %d is %+v, the shifted copy at the origin gives %+v", i, ap, ap0)
+		}
+	}
+}
+
+// TestIntervalDepthAlpha 用左边两列透明、其余为不透明灰色 (200) 的 5x5 目标图检查区间深度跳过透明的邻居：
+// 紧挨透明区域的像素的 3x3、5x5 平均值和深度都应为 200，而不被透明格子在灰度网格中的 0 拉低
+func TestIntervalDepthAlpha(t *testing.T) {
+	bounds := image.Rect(0, 0, 5, 5)
+	img := image.NewRGBA(bounds)
+	for y := 0; y < 5; y++ {
+		for x := 2; x < 5; x++ {
+			img.SetRGBA(x, y, color.RGBA{200, 200, 200, 0xFF})
+		}
+	}
+	grid := buildGrayGrid(img)
+	visible := buildVisibleGrid(img, depthMinAlpha)
+	if visible == nil {
+		t.Fatal("a partially transparent image has no visibility grid")
+	}
+	got := [3]float64{
+		calculateAverageGray(2, 2, 1, grid, visible, bounds),
+		calculateAverageGray(2, 2, 2, grid, visible, bounds),
+		calculateIntervalDepth(2, 2, grid, visible, bounds),
+	}
+	if want := [3]float64{200, 200, 200}; got != want {
+		t.Errorf("3x3/5x5/depth next to transparent cells = %v, want %v", got, want)
+	}
+	if unmasked := calculateAverageGray(2, 2, 1, grid, nil, bounds); unmasked >= 200 {
+		t.Errorf("without the visibility grid the 3x3 average is %v; the test would not detect transparent neighbors", unmasked)
+	}
+	if buildVisibleGrid(solidImage(bounds, color.RGBA{1, 2, 3, 0xFF}), depthMinAlpha) != nil {
+		t.Error("an opaque image got a visibility grid")
+	}
+}
+
+// TestPlanClone 检查修改 Clone 得到的副本不会影响原计划
+func TestPlanClone(t *testing.T) {
+	fx := fixturePairs()[0]
+	plan := CreateAnimationPlan(fx.Source, fx.Target, PlanOptions{})
+	want := append([]AnimationPixel(nil), plan.Pixels...)
+
+	clone := plan.Clone()
+	if clone.Frames != plan.Frames || clone.Bounds != plan.Bounds || len(clone.Pixels) != len(plan.Pixels) {
+		t.Fatalf("clone has %d frames, bounds %v and %d pixels, want %d, %v and %d",
+			clone.Frames, clone.Bounds, len(clone.Pixels), plan.Frames, plan.Bounds, len(plan.Pixels))
+	}
+	for i := range clone.Pixels {
+		clone.Pixels[i].TargetX, clone.Pixels[i].TargetY = clone.Pixels[i].StartX, clone.Pixels[i].StartY
+		clone.Pixels[i].Color = color.RGBA{}
+	}
+	clone.Pixels = clone.Pixels[:1]
+	clone.Frames = 1
+	if plan.Frames == 1 || len(plan.Pixels) != len(want) {
+		t.Fatalf("changing the clone changed the plan's frames or pixel count")
+	}
+	for i := range want {
+		if plan.Pixels[i] != want[i] {
+			t.Fatalf("changing the clone changed pixel %d of the plan to %+v, want %+v", i, plan.Pixels[i], want[i])
+		}
+	}
+}
+
+// TestPlanReverse 检查 Reverse 不修改原计划、反转后的计划最后一帧是源图像，并且反转两次得到原计划
+func TestPlanReverse(t *testing.T) {
+	for _, fx := range fixturePairs() {
+		t.Run(fx.Name, func(t *testing.T) {
+			plan := CreateAnimationPlan(fx.Source, fx.Target, PlanOptions{})
+			want := append([]AnimationPixel(nil), plan.Pixels...)
+
+			reversed := plan.Reverse()
+			for i := range want {
+				if plan.Pixels[i] != want[i] {
+					t.Fatalf("Reverse changed pixel %d of the plan to %+v, want %+v", i, plan.Pixels[i], want[i])
+				}
+			}
+			final := renderTarget(reversed)
+			b := fx.Source.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					if got, want := final.RGBAAt(x, y), toRGBA(fx.Source.At(x, y)); got != want {
+						t.Fatalf("reversed plan ends with %v at (%d,%d), source has %v", got, x, y, want)
+					}
+				}
+			}
+
+			twice := reversed.Reverse()
+			if twice.Frames != plan.Frames || twice.Bounds != plan.Bounds || len(twice.Pixels) != len(want) {
+				t.Fatalf("reversing twice gives %d frames, bounds %v and %d pixels, want %d, %v and %d",
+					twice.Frames, twice.Bounds, len(twice.Pixels), plan.Frames, plan.Bounds, len(want))
+			}
+			for i := range want {
+				if twice.Pixels[i] != want[i] {
+					t.Fatalf("reversing twice gives pixel %d = %+v, want %+v", i, twice.Pixels[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestSortDescending 检查 PlanOptions.Descending 让按灰度排序的算法从亮到暗排序并记录在计划中，
+// 并且 wave 运动按计划的 Descending 决定先出发的是暗的还是亮的像素
+func TestSortDescending(t *testing.T) {
+	fx := fixturePairs()[0]
+	for _, name := range []string{"default", "featured", "edge"} {
+		asc, err := createPlan(name, fx.Source, fx.Target, PlanOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		desc, err := createPlan(name, fx.Source, fx.Target, PlanOptions{Descending: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if asc.Descending || !desc.Descending {
+			t.Errorf("%s: plans record Descending %v and %v, want false and true", name, asc.Descending, desc.Descending)
+		}
+		if err := checkPlanInvariants(desc, fx.Source); err != nil {
+			t.Errorf("%s: descending plan: %v", name, err)
+		}
+		// 按灰度从暗到亮排在第 i 位的源像素，在降序的计划中被分配到从亮到暗排在第 i 位的目标位置
+		for i := range asc.Pixels {
+			a, d := asc.Pixels[i], desc.Pixels[len(desc.Pixels)-1-i]
+			if grayscaleOf(a.Color) != grayscaleOf(d.Color) {
+				t.Fatalf("%s: rank %d has gray %v ascending, but %v descending", name, i, grayscaleOf(a.Color), grayscaleOf(d.Color))
+			}
+		}
+	}
+
+	// wave 运动中每个像素用 0.2*20 = 4 步走完，最先出发的像素在第 4 步已经到达，最后出发的像素还没有动
+	for _, descending := range []bool{false, true} {
+		plan, err := createPlan("default", fx.Source, fx.Target, PlanOptions{Descending: descending})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var darkest, brightest AnimationPixel
+		found := false
+		for _, ap := range plan.Pixels {
+			if ap.StartX == ap.TargetX && ap.StartY == ap.TargetY {
+				continue
+			}
+			if !found || grayscaleOf(ap.Color) < grayscaleOf(darkest.Color) {
+				darkest = ap
+			}
+			if !found || grayscaleOf(ap.Color) > grayscaleOf(brightest.Color) {
+				brightest = ap
+			}
+			found = true
+		}
+		motion := waveMotion(plan, 20, 0.2)
+		moved := func(ap AnimationPixel) bool {
+			state := pixelState{X: ap.StartX, Y: ap.StartY}
+			motion(ap, &state, 4)
+			return state.X != ap.StartX || state.Y != ap.StartY
+		}
+		if moved(darkest) == descending || moved(brightest) != descending {
+			t.Errorf("descending %v: after four wave steps the darkest pixel moved %v and the brightest moved %v",
+				descending, moved(darkest), moved(brightest))
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// fitSize 在保持宽高比的前提下，把 w x h 缩小到不超过 maxW x maxH（不会放大）
+func fitSize(w, h, maxW, maxH int) (int, int) {
+	if w <= maxW && h <= maxH {
+		return w, h
+	}
+	scale := min(float64(maxW)/float64(w), float64(maxH)/float64(h))
+	return max(1, int(float64(w)*scale)), max(1, int(float64(h)*scale))
+}
+
+// ResampleKind 选择 Resample 使用的采样方式
+type ResampleKind int
+
+const (
+	// ResampleNearest 取最近的源像素，不混合颜色，适合像素画和需要保持调色板的场合
+	ResampleNearest ResampleKind = iota
+	// ResampleBilinear 在最近的 2x2 个源像素之间线性插值，缩放后更平滑
+	ResampleBilinear
+)
+
+// Resample 把图像缩放为 w x h（可以缩小也可以放大），结果的左上角为原点。
+// 双线性插值按像素中心对齐，超出边缘的采样点取边缘像素，插值在预乘 alpha 的 RGBA 分量上进行，
+// 因此透明像素不会把颜色渗到相邻的像素中
+func Resample(src image.Image, w, h int, kind ResampleKind) *image.RGBA {
+	rgba, ok := src.(*image.RGBA)
+	if !ok {
+		rgba = toRGBAImage(src)
+	}
+	b := rgba.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	if kind == ResampleNearest {
+		for y := 0; y < h; y++ {
+			sy := b.Min.Y + y*b.Dy()/h
+			for x := 0; x < w; x++ {
+				sx := b.Min.X + x*b.Dx()/w
+				dst.SetRGBA(x, y, rgba.RGBAAt(sx, sy))
+			}
+		}
+		return dst
+	}
+
+	for y := 0; y < h; y++ {
+		y0, y1, fy := bilinearAxis(y, h, b.Min.Y, b.Dy())
+		for x := 0; x < w; x++ {
+			x0, x1, fx := bilinearAxis(x, w, b.Min.X, b.Dx())
+			i00, i10 := rgba.PixOffset(x0, y0), rgba.PixOffset(x1, y0)
+			i01, i11 := rgba.PixOffset(x0, y1), rgba.PixOffset(x1, y1)
+			d := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				top := float64(rgba.Pix[i00+c])*(1-fx) + float64(rgba.Pix[i10+c])*fx
+				bottom := float64(rgba.Pix[i01+c])*(1-fx) + float64(rgba.Pix[i11+c])*fx
+				dst.Pix[d+c] = uint8(top*(1-fy) + bottom*fy + 0.5)
+			}
+		}
+	}
+	return dst
+}
+
+// bilinearAxis 把输出坐标 i（共 n 个）按像素中心映射到长度为 size、起点为 origin 的源坐标轴上，
+// 返回两侧的源坐标和第二个的权重
+func bilinearAxis(i, n, origin, size int) (int, int, float64) {
+	s := (float64(i)+0.5)*float64(size)/float64(n) - 0.5
+	s = max(0, min(s, float64(size-1)))
+	i0 := int(s)
+	i1 := i0
+	if i0 < size-1 {
+		i1++
+	}
+	return origin + i0, origin + i1, s - float64(i0)
+}
+
+// OutputSize 描述输出帧的尺寸。动画仍然按输入图像的原始分辨率计算，只在编码前缩放输出的帧。
+// 缩放使用最近邻采样，保持像素的颜色不被混合（透明的空格子也保持透明）
+type OutputSize struct {
+	// Width 和 Height 为 0 时不缩放
+	Width, Height int
+	// Fit 为 true 时保持宽高比，缩放到恰好放进 Width x Height 的最大尺寸；否则拉伸到 Width x Height
+	Fit bool
+}
+
+// parseOutputSize 解析 WxH 形式的尺寸，空字符串表示不缩放
+func parseOutputSize(s string, fit bool) (OutputSize, error) {
+	if s == "" {
+		return OutputSize{}, nil
+	}
+	ws, hs, ok := strings.Cut(strings.ToLower(s), "x")
+	w, errW := strconv.Atoi(ws)
+	h, errH := strconv.Atoi(hs)
+	if !ok || errW != nil || errH != nil || w < 1 || h < 1 {
+		return OutputSize{}, fmt.Errorf("invalid output size %q: use WxH, e.g. 320x240", s)
+	}
+	return OutputSize{Width: w, Height: h, Fit: fit}, nil
+}
+
+// size 返回尺寸为 w x h 的帧缩放后的尺寸
+func (o OutputSize) size(w, h int) (int, int) {
+	if !o.Fit {
+		return o.Width, o.Height
+	}
+	scale := min(float64(o.Width)/float64(w), float64(o.Height)/float64(h))
+	return max(1, int(float64(w)*scale+0.5)), max(1, int(float64(h)*scale+0.5))
+}
+
+// Apply 把帧缩放为输出尺寸，未设置输出尺寸或尺寸不变时原样返回
+func (o OutputSize) Apply(img *image.RGBA) *image.RGBA {
+	if o.Width == 0 || o.Height == 0 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := o.size(b.Dx(), b.Dy())
+	if w == b.Dx() && h == b.Dy() {
+		return img
+	}
+	return Resample(img, w, h, ResampleNearest)
+}
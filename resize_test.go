@@ -0,0 +1,47 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// TestResample 用手工计算过结果的小灰度图检查 Resample 两种采样方式的放大、缩小，以及 1 像素宽的边缘情况
+func TestResample(t *testing.T) {
+	gray := func(w, h int, values ...uint8) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		for i, v := range values {
+			img.SetRGBA(i%w, i/w, color.RGBA{v, v, v, 0xFF})
+		}
+		return img
+	}
+	for _, tc := range []struct {
+		name string
+		src  *image.RGBA
+		w, h int
+		kind ResampleKind
+		want []uint8
+	}{
+		{"nearest/up 2x2 to 4x2", gray(2, 2, 10, 20, 30, 40), 4, 2, ResampleNearest, []uint8{10, 10, 20, 20, 30, 30, 40, 40}},
+		{"nearest/down 4x1 to 2x1", gray(4, 1, 0, 100, 200, 255), 2, 1, ResampleNearest, []uint8{0, 200}},
+		{"nearest/edge 1x1 to 3x2", gray(1, 1, 77), 3, 2, ResampleNearest, []uint8{77, 77, 77, 77, 77, 77}},
+		{"nearest/edge 1x3 to 1x1", gray(1, 3, 10, 20, 30), 1, 1, ResampleNearest, []uint8{10}},
+		{"bilinear/up 2x1 to 4x1", gray(2, 1, 0, 255), 4, 1, ResampleBilinear, []uint8{0, 64, 191, 255}},
+		{"bilinear/down 4x1 to 2x1", gray(4, 1, 0, 100, 200, 255), 2, 1, ResampleBilinear, []uint8{50, 228}},
+		{"bilinear/edge 1x1 to 3x2", gray(1, 1, 77), 3, 2, ResampleBilinear, []uint8{77, 77, 77, 77, 77, 77}},
+		{"bilinear/edge 1x2 to 1x4", gray(1, 2, 0, 200), 1, 4, ResampleBilinear, []uint8{0, 50, 150, 200}},
+		{"bilinear/edge 1x3 to 1x1", gray(1, 3, 10, 20, 30), 1, 1, ResampleBilinear, []uint8{20}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Resample(tc.src, tc.w, tc.h, tc.kind)
+			if got.Bounds() != image.Rect(0, 0, tc.w, tc.h) {
+				t.Fatalf("bounds %v, want %dx%d", got.Bounds(), tc.w, tc.h)
+			}
+			for i, v := range tc.want {
+				if px := got.RGBAAt(i%tc.w, i/tc.w); px != (color.RGBA{v, v, v, 0xFF}) {
+					t.Errorf("pixel %d is %v, want gray %d", i, px, v)
+				}
+			}
+		})
+	}
+}
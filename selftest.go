@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// selftestTolerance 是 GIF 调色板量化后允许的灰度总和相对误差
+const selftestTolerance = 0.03
+
+// selftestMotions 是自检时使用的所有运动方式
+var selftestMotions = []string{"random", "dither", "deterministic", "line", "gravity", "wave"}
+
+// selftestImages 在内存中生成一对尺寸相同的合成图片：源图是彩色渐变，目标图是背景上的亮圆
+func selftestImages() (image.Image, image.Image) {
+	bounds := image.Rect(0, 0, 32, 24)
+	source := image.NewRGBA(bounds)
+	target := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			source.Set(x, y, color.RGBA{uint8(x * 8), uint8(y * 10), uint8(255 - x*4), 0xFF})
+			if (x-16)*(x-16)+(y-12)*(y-12) < 64 {
+				target.Set(x, y, color.RGBA{0xF0, 0xE0, 0xC0, 0xFF})
+			} else {
+				target.Set(x, y, color.RGBA{uint8(x * 2), 0x20, uint8(y * 6), 0xFF})
+			}
+		}
+	}
+	return source, target
+}
+
+// runSelftest 对每种算法和运动方式执行一次完整的往返：计算计划、编码 PNG 和 GIF 到临时目录、
+// 再解码并用 CalculateGrayscaleSum 检查结果。report 会收到每个用例的结果，返回失败的用例数
+func runSelftest(report func(name string, err error)) int {
+	dir, err := os.MkdirTemp("", "img2video-selftest-")
+	if err != nil {
+		report("create temp dir", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	sourceImg, targetImg := selftestImages()
+	sourceSum := CalculateGrayscaleSum(sourceImg)
+
+	failures := 0
+	check := func(name string, err error) {
+		if err != nil {
+			failures++
+		}
+		report(name, err)
+	}
+
+	check("png/alpha", selftestAlphaPNG(filepath.Join(dir, "alpha.png")))
+	check("pixel count", selftestPixelCount(sourceImg))
+	check("curve", selftestCurve())
+	check("gif/exact", selftestExactPalette(sourceImg))
+	check("crop to content", selftestCropToContent())
+	check("sort strip", selftestSortStrip(sourceImg))
+	check("gif/loopdelay", selftestLoopDelay(sourceImg, targetImg))
+	check("plan json", selftestPlanJSON(sourceImg, targetImg, filepath.Join(dir, "plan.json")))
+
+	for _, name := range algorithmNames() {
+		plan := algorithms[name].Plan(sourceImg, targetImg, PlanOptions{})
+
+		pngPath := filepath.Join(dir, name+".png")
+		check(name+"/png", selftestPNG(plan, pngPath, sourceSum))
+
+		for _, motion := range selftestMotions {
+			gifPath := filepath.Join(dir, name+"-"+motion+".gif")
+			check(name+"/gif/"+motion, selftestGIF(plan, gifPath, motion, sourceSum))
+		}
+	}
+	return failures
+}
+
+// selftestPNG 保存 PNG 并检查解码后的灰度总和与源图完全一致（PNG 是无损的）
+func selftestPNG(plan *AnimationPlan, path string, sourceSum float64) error {
+	if err := SaveImage(plan, path, ImageOptions{}); err != nil {
+		return err
+	}
+	img, err := readImage(path, 0)
+	if err != nil {
+		return err
+	}
+	if sum := CalculateGrayscaleSum(img); math.Abs(sum-sourceSum) > 0.0001 {
+		return fmt.Errorf("grayscale sum %f differs from source %f", sum, sourceSum)
+	}
+	return nil
+}
+
+// selftestGIF 保存 GIF，并检查最后一帧的灰度总和在量化误差范围内与源图一致
+func selftestGIF(plan *AnimationPlan, path, motion string, sourceSum float64) error {
+	opts := GIFOptions{FrameOptions: FrameOptions{Motion: motion}}
+	if _, err := SaveGIF(plan, path, 1, opts); err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	g, err := gif.DecodeAll(file)
+	if err != nil {
+		return err
+	}
+	if len(g.Image) < 2 {
+		return fmt.Errorf("expected at least 2 frames, got %d", len(g.Image))
+	}
+	sum := CalculateGrayscaleSum(g.Image[len(g.Image)-1])
+	if math.Abs(sum-sourceSum) > sourceSum*selftestTolerance {
+		return fmt.Errorf("last frame grayscale sum %f is not within %.0f%% of source %f", sum, selftestTolerance*100, sourceSum)
+	}
+	return nil
+}
+
+// selftestAlphaPNG 用带有完全透明、半透明和不透明像素的源图生成 PNG，检查每个像素到达目标位置后
+// 颜色和 alpha 都与源像素完全一致，即透明度经过编码和解码后仍然保留
+func selftestAlphaPNG(path string) error {
+	bounds := image.Rect(0, 0, 12, 9)
+	source := image.NewNRGBA(bounds)
+	target := image.NewNRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			source.SetNRGBA(x, y, color.NRGBA{uint8(x * 20), uint8(y * 25), 0x80, uint8((x + y*bounds.Dx()) * 255 / (bounds.Dx()*bounds.Dy() - 1))})
+			target.SetNRGBA(x, y, color.NRGBA{uint8(255 - y*25), uint8(x * 20), 0x40, 0xFF})
+		}
+	}
+	plan := CreateAnimationPlan(source, target, PlanOptions{})
+	if err := SaveImage(plan, path, ImageOptions{}); err != nil {
+		return err
+	}
+	img, err := readImage(path, 0)
+	if err != nil {
+		return err
+	}
+	for _, ap := range plan.Pixels {
+		if got := toRGBA(img.At(ap.TargetX, ap.TargetY)); got != ap.Color {
+			return fmt.Errorf("pixel at (%d,%d) is %v after decoding, want %v", ap.TargetX, ap.TargetY, got, ap.Color)
+		}
+	}
+	return nil
+}
+
+// selftestPixelCount 检查 checkPixelCount 接受完整的像素列表，而拒绝故意删掉或重复了一个像素的列表，
+// 以及遮罩图像有意只产生部分像素时不报错
+func selftestPixelCount(img image.Image) error {
+	pixels := imageToPixels(img)
+	if err := checkPixelCount(img, pixels); err != nil {
+		return err
+	}
+	if checkPixelCount(img, pixels[1:]) == nil {
+		return fmt.Errorf("a pixel list missing one pixel was accepted")
+	}
+	if checkPixelCount(img, append(pixels, pixels[0])) == nil {
+		return fmt.Errorf("a pixel list with a duplicated pixel was accepted")
+	}
+	masked := maskedImage{img, func(x, y int) bool { return x%2 == 0 }}
+	return checkPixelCount(masked, imageToPixels(masked))
+}
+
+// selftestCurve 检查两种空间填充曲线都恰好经过每个点一次，并且正方形上的 Hilbert 曲线和牛耕式曲线中
+// 相邻的两个点在图像中也相邻；非 2 的幂的尺寸只检查覆盖
+func selftestCurve() error {
+	for _, c := range []struct {
+		curve    string
+		bounds   image.Rectangle
+		adjacent bool
+	}{
+		{"hilbert", image.Rect(0, 0, 16, 16), true},
+		{"hilbert", image.Rect(3, 5, 13, 12), false},
+		{"boustrophedon", image.Rect(3, 5, 13, 12), true},
+	} {
+		order, err := curveOrder(c.bounds, c.curve)
+		if err != nil {
+			return err
+		}
+		seen := map[image.Point]bool{}
+		for i, p := range order {
+			if !p.In(c.bounds) || seen[p] {
+				return fmt.Errorf("%s %v: point %v is outside or visited twice", c.curve, c.bounds, p)
+			}
+			seen[p] = true
+			if c.adjacent && i > 0 {
+				if d := p.Sub(order[i-1]); abs(d.X)+abs(d.Y) != 1 {
+					return fmt.Errorf("%s %v: %v and %v are consecutive but not adjacent", c.curve, c.bounds, order[i-1], p)
+				}
+			}
+		}
+		if len(seen) != c.bounds.Dx()*c.bounds.Dy() {
+			return fmt.Errorf("%s %v: visited %d points, want %d", c.curve, c.bounds, len(seen), c.bounds.Dx()*c.bounds.Dy())
+		}
+	}
+	return nil
+}
+
+// selftestExactPalette 检查少于 256 色的动画自动使用精确调色板：解码后每一帧都与渲染的帧逐像素相同，
+// 而颜色过多的图像（合成的渐变）会退回到量化
+func selftestExactPalette(manyColors image.Image) error {
+	b := image.Rect(0, 0, 12, 9)
+	colors := []color.RGBA{{0xE0, 0x40, 0x30, 0xFF}, {0x20, 0x90, 0xD0, 0xFF}, {0xF0, 0xD0, 0x10, 0xFF}, {0x55, 0x55, 0x55, 0xFF}}
+	source, target := image.NewRGBA(b), image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			source.SetRGBA(x, y, colors[(x/3+y/3)%len(colors)])
+			target.SetRGBA(x, y, colors[(x*y)%len(colors)])
+		}
+	}
+	plan := CreateAnimationPlan(source, target, PlanOptions{})
+	opts := GIFOptions{FrameOptions: FrameOptions{Motion: "deterministic"}, ExactPalette: true}
+	var buf bytes.Buffer
+	if _, err := EncodeGIF(&buf, plan, 1, opts); err != nil {
+		return err
+	}
+	decoded, err := gif.DecodeAll(&buf)
+	if err != nil {
+		return err
+	}
+	var rendered []*image.RGBA
+	if _, err := RenderFrames(plan, opts.FrameOptions, func(frame *image.RGBA) {
+		rendered = append(rendered, frame)
+	}); err != nil {
+		return err
+	}
+	if len(rendered) != len(decoded.Image) {
+		return fmt.Errorf("decoded %d frames, rendered %d", len(decoded.Image), len(rendered))
+	}
+	black := color.RGBA{0, 0, 0, 0xFF}
+	for i, frame := range decoded.Image {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				want := rendered[i].RGBAAt(x, y)
+				if want.A == 0 {
+					want = black
+				}
+				if got := toRGBA(frame.At(x, y)); got != want {
+					return fmt.Errorf("frame %d pixel (%d,%d) is %v, want %v", i, x, y, got, want)
+				}
+			}
+		}
+	}
+	if p := exactPalette([]*image.RGBA{toRGBAImage(manyColors)}, maxPaletteSize); p != nil {
+		return fmt.Errorf("an image with %d colors got an exact palette of %d colors", UniqueColors(manyColors), len(p))
+	}
+	return nil
+}
+
+// selftestCropToContent 检查 -crop-to-content 把两张白底图片裁剪到内容外接矩形的交集，
+// 容差以内的杂色仍算作边框，而内容不重叠时报错
+func selftestCropToContent() error {
+	b := image.Rect(0, 0, 20, 16)
+	white := color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	withContent := func(content image.Rectangle) *image.RGBA {
+		img := solidImage(b, white)
+		for y := content.Min.Y; y < content.Max.Y; y++ {
+			for x := content.Min.X; x < content.Max.X; x++ {
+				img.SetRGBA(x, y, color.RGBA{uint8(x * 10), uint8(y * 10), 0x40, 0xFF})
+			}
+		}
+		// 边框上接近白色的杂色不影响裁剪
+		img.SetRGBA(19, 0, color.RGBA{0xF8, 0xFA, 0xFF, 0xFF})
+		return img
+	}
+	source := withContent(image.Rect(3, 2, 12, 10))
+	target := withContent(image.Rect(5, 4, 15, 13))
+	croppedSource, croppedTarget, r, err := cropToContent(source, target, 16)
+	if err != nil {
+		return err
+	}
+	if want := image.Rect(5, 4, 12, 10); r != want {
+		return fmt.Errorf("cropped to %v, want %v", r, want)
+	}
+	if got := croppedSource.Bounds(); got != image.Rect(0, 0, 7, 6) || croppedTarget.Bounds() != got {
+		return fmt.Errorf("cropped images are %v and %v, want 7x6 at the origin", got, croppedTarget.Bounds())
+	}
+	if got, want := toRGBA(croppedTarget.At(0, 0)), target.RGBAAt(5, 4); got != want {
+		return fmt.Errorf("cropped target starts with %v, want %v", got, want)
+	}
+	if _, _, _, err := cropToContent(withContent(image.Rect(1, 1, 5, 5)), withContent(image.Rect(10, 10, 14, 14)), 16); err == nil {
+		return fmt.Errorf("cropping images whose content does not overlap succeeded")
+	}
+	return nil
+}
+
+// selftestSortStrip 检查 default 算法的排序像素条按行读出时灰度单调不减，并且恰好包含原图的每个像素
+func selftestSortStrip(img image.Image) error {
+	b := img.Bounds()
+	strip, err := SortStrip(img, "default", b.Dx())
+	if err != nil {
+		return err
+	}
+	if sb := strip.Bounds(); sb.Dx() != b.Dx() || sb.Dy() != b.Dy() {
+		return fmt.Errorf("strip is %dx%d, want %dx%d", sb.Dx(), sb.Dy(), b.Dx(), b.Dy())
+	}
+	if got, want := CalculateGrayscaleSum(strip), CalculateGrayscaleSum(img); math.Abs(got-want) > 0.01 {
+		return fmt.Errorf("strip grayscale sum %f, want %f", got, want)
+	}
+	prev := -1.0
+	for i := 0; i < b.Dx()*b.Dy(); i++ {
+		g := grayscaleOf(strip.RGBAAt(i%b.Dx(), i/b.Dx()))
+		if g < prev {
+			return fmt.Errorf("pixel %d of the strip has grayscale %.2f after %.2f", i, g, prev)
+		}
+		prev = g
+	}
+	return nil
+}
+
+// selftestPlanJSON 检查计划保存为 JSON 再读回后与原计划完全一致、与自身比较时没有差别，
+// 并且交换两个像素的终点后 diffPlans 报告恰好两个像素改变，落在对应距离的直方图区间中
+func selftestPlanJSON(sourceImg, targetImg image.Image, path string) error {
+	plan, err := createPlan("default", sourceImg, targetImg, PlanOptions{})
+	if err != nil {
+		return err
+	}
+	if err := SavePlanJSON(plan, path); err != nil {
+		return err
+	}
+	loaded, err := LoadPlanJSON(path)
+	if err != nil {
+		return err
+	}
+	if loaded.Frames != plan.Frames || loaded.Bounds != plan.Bounds || !slices.Equal(loaded.Pixels, plan.Pixels) {
+		return fmt.Errorf("the plan read back differs from the saved plan")
+	}
+	same, err := diffPlans(plan, loaded)
+	if err != nil {
+		return err
+	}
+	if same.Matched != len(plan.Pixels) || same.Changed != 0 || same.Unmatched != 0 {
+		return fmt.Errorf("diff of a plan with itself: %+v", same)
+	}
+
+	// 找到一个终点与第 0 个像素的终点相距 3 的像素，交换两者的终点：距离落在 [2,4) 区间
+	swapped := plan.Clone()
+	p := swapped.Pixels
+	j := slices.IndexFunc(p, func(ap AnimationPixel) bool {
+		return Euclidean(ap.TargetX, ap.TargetY, p[0].TargetX, p[0].TargetY) == 3
+	})
+	if j < 0 {
+		return fmt.Errorf("no pixel has a target 3 pixels from the first one")
+	}
+	p[0].TargetX, p[0].TargetY, p[j].TargetX, p[j].TargetY = p[j].TargetX, p[j].TargetY, p[0].TargetX, p[0].TargetY
+	diff, err := diffPlans(plan, swapped)
+	if err != nil {
+		return err
+	}
+	if diff.Changed != 2 || diff.MaxShift != 3 || len(diff.Histogram) != 3 || diff.Histogram[2] != 2 {
+		return fmt.Errorf("diff after swapping two targets: %+v", diff)
+	}
+	return nil
+}
+
+// selftestLoopDelay 检查 LoopDelay 只改变最后一帧的延迟，设置了 Boomerang 时改变返回段的最后一帧，
+// 并且串联动画最后一段的 Hold 仍然加在它上面
+func selftestLoopDelay(sourceImg, targetImg image.Image) error {
+	plan, err := createPlan("default", sourceImg, targetImg, PlanOptions{})
+	if err != nil {
+		return err
+	}
+	opts := GIFOptions{FrameOptions: FrameOptions{Motion: "line"}, LoopDelay: 50}
+	delays := func(encode func(w io.Writer) error) ([]int, error) {
+		var buf bytes.Buffer
+		if err := encode(&buf); err != nil {
+			return nil, err
+		}
+		g, err := gif.DecodeAll(&buf)
+		if err != nil {
+			return nil, err
+		}
+		return g.Delay, nil
+	}
+	for _, boomerang := range []bool{false, true} {
+		opts.Boomerang = boomerang
+		got, err := delays(func(w io.Writer) error {
+			_, err := EncodeGIF(w, plan, 3, opts)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		last := len(got) - 1
+		if got[last] != 50 || slices.ContainsFunc(got[:last], func(d int) bool { return d != 3 }) {
+			return fmt.Errorf("boomerang %v: delays %v, want 3 on every frame but 50 on the last", boomerang, got)
+		}
+	}
+
+	opts.Boomerang = false
+	got, err := delays(func(w io.Writer) error {
+		return EncodeChainedGIF(w, []image.Image{sourceImg, targetImg, sourceImg}, "default", PlanOptions{}, []int{3, 3}, []int{0, 7}, opts)
+	})
+	if err != nil {
+		return err
+	}
+	if last := got[len(got)-1]; last != 57 {
+		return fmt.Errorf("chained GIF with a final hold of 7: last delay %d, want 57", last)
+	}
+	return nil
+}
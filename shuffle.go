@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"image"
+	"math/rand"
+)
+
+// CreateAnimationPlanShuffle 不按灰度排序，而是用带种子的 Fisher-Yates 洗牌把目标位置随机分配给源像素，
+// 仍然保持一一对应。动画中图像先溶解为噪点，最后每个像素停在随机的位置上。随机种子是 opts.Seed
+func CreateAnimationPlanShuffle(sourceImg, targetImg image.Image, opts PlanOptions) *AnimationPlan {
+	sourcePixels := imageToPixels(sourceImg)
+	targetPixels := imageToPixels(targetImg)
+
+	r := rand.New(rand.NewSource(opts.Seed))
+	for i := len(targetPixels) - 1; i > 0; i-- {
+		j := r.Intn(i + 1)
+		targetPixels[i], targetPixels[j] = targetPixels[j], targetPixels[i]
+	}
+
+	targetPixelsFeatured := make([]PixelFeatured, len(targetPixels))
+	for i, p := range targetPixels {
+		targetPixelsFeatured[i] = PixelFeatured{Pixel: p}
+	}
+	return calculatePlan(sourcePixels, targetPixelsFeatured, sourceImg.Bounds())
+}
+
+// imageSeed 根据图像的尺寸和像素内容计算一个 FNV-1a 哈希作为随机种子，
+// 相同的输入图像总是得到相同的种子
+func imageSeed(images ...image.Image) int64 {
+	h := fnv.New64a()
+	for _, img := range images {
+		b := img.Bounds()
+		fmt.Fprintf(h, "%d,%d,%d,%d;", b.Min.X, b.Min.Y, b.Max.X, b.Max.Y)
+		for p := range imagePixels(img) {
+			h.Write([]byte{p.Color.R, p.Color.G, p.Color.B, p.Color.A})
+		}
+	}
+	// 0 表示使用当前时间作为种子，因此避开这个值
+	return int64(h.Sum64()) | 1
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+// TestShuffleSeed 检查 shuffle 算法只由 PlanOptions.Seed 决定：相同的种子得到相同的计划，不同的种子得到不同的计划
+func TestShuffleSeed(t *testing.T) {
+	fx := fixturePairs()[0]
+	plan := func(seed int64) *AnimationPlan {
+		plan, err := createPlan("shuffle", fx.Source, fx.Target, PlanOptions{Seed: seed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return plan
+	}
+	same := func(a, b *AnimationPlan) bool {
+		for i := range a.Pixels {
+			if a.Pixels[i] != b.Pixels[i] {
+				return false
+			}
+		}
+		return true
+	}
+	if !same(plan(7), plan(7)) {
+		t.Error("two plans with seed 7 differ")
+	}
+	if same(plan(7), plan(8)) {
+		t.Error("seeds 7 and 8 give the same plan")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"slices"
+	"strings"
+)
+
+// hilbertIndex 返回点 (x, y) 在边长为 n（2 的幂）的 Hilbert 曲线上的序号。
+// 沿序号递增的顺序遍历时，相邻的两个点在图像中也总是相邻的
+func hilbertIndex(n, x, y int) int {
+	d := 0
+	for s := n / 2; s > 0; s /= 2 {
+		rx, ry := 0, 0
+		if x&s != 0 {
+			rx = 1
+		}
+		if y&s != 0 {
+			ry = 1
+		}
+		d += s * s * ((3 * rx) ^ ry)
+		// 把子象限旋转回标准方向，使下一层按同样的规则计算
+		if ry == 0 {
+			if rx == 1 {
+				x, y = n-1-x, n-1-y
+			}
+			x, y = y, x
+		}
+	}
+	return d
+}
+
+// curveOrder 返回 bounds 中所有点按空间填充曲线排列的顺序：
+//   - hilbert: Hilbert 曲线，非正方形或边长不是 2 的幂的图像按包含它的最小 2 的幂正方形计算后跳过外面的点
+//   - boustrophedon: 逐行扫描，偶数行从左到右、奇数行从右到左，像牛耕地一样往返
+func curveOrder(bounds image.Rectangle, curve string) ([]image.Point, error) {
+	w, h := bounds.Dx(), bounds.Dy()
+	var index func(x, y int) int
+	switch strings.ToLower(curve) {
+	case "", "hilbert":
+		n := 1
+		for n < max(w, h) {
+			n *= 2
+		}
+		index = func(x, y int) int { return hilbertIndex(n, x, y) }
+	case "boustrophedon":
+		index = func(x, y int) int {
+			if y%2 == 1 {
+				x = w - 1 - x
+			}
+			return y*w + x
+		}
+	default:
+		return nil, fmt.Errorf("unknown curve: %s. Please use 'hilbert' or 'boustrophedon'", curve)
+	}
+
+	type indexed struct {
+		p image.Point
+		d int
+	}
+	points := make([]indexed, 0, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			points = append(points, indexed{bounds.Min.Add(image.Pt(x, y)), index(x, y)})
+		}
+	}
+	slices.SortFunc(points, func(a, b indexed) int { return a.d - b.d })
+	order := make([]image.Point, len(points))
+	for i, p := range points {
+		order[i] = p.p
+	}
+	return order, nil
+}
+
+// EncodeSnake 生成沿空间填充曲线逐步画出目标图像的 GIF 并写入 w：像素不移动，而是按曲线的顺序依次出现，
+// 像一支笔沿曲线一笔画完整张图。第 i 帧显示曲线上前 i/(frames-1) 比例的像素，第一帧为空，最后一帧是完整的目标图像。
+// 尚未画到的位置是透明的（不使用 Transparent 时被量化为调色板中最接近黑色的颜色）
+func EncodeSnake(w io.Writer, targetImg image.Image, curve string, frames, delay int, opts GIFOptions) (GIFResult, error) {
+	if frames < 2 {
+		return GIFResult{}, fmt.Errorf("a snake reveal needs at least 2 frames, got %d", frames)
+	}
+	order, err := curveOrder(targetImg.Bounds(), curve)
+	if err != nil {
+		return GIFResult{}, err
+	}
+	target := toRGBAImage(targetImg)
+
+	samples := func() []*image.RGBA { return []*image.RGBA{target} }
+	return encodeFrames(w, samples, opts, func(sink *frameSink) error {
+		// 每一帧在上一帧的基础上画出新的一段曲线，交给 sink 的是副本
+		canvas := image.NewRGBA(target.Rect)
+		drawn := 0
+		for i := 0; i < frames; i++ {
+			end := len(order) * i / (frames - 1)
+			for _, p := range order[drawn:end] {
+				canvas.SetRGBA(p.X, p.Y, target.RGBAAt(p.X, p.Y))
+			}
+			drawn = end
+			frame := getFrame(canvas.Rect)
+			copy(frame.Pix, canvas.Pix)
+			sink.Add(frame, delay)
+		}
+		return nil
+	})
+}
+
+// SaveSnake 生成沿曲线画出目标图像的 GIF 并保存到 outputPath（见 EncodeSnake）
+func SaveSnake(targetImg image.Image, curve string, frames int, outputPath string, delay int, opts GIFOptions) (GIFResult, error) {
+	log.Printf("正在生成沿 %s 曲线画出图像的动画并编码到 %s...", curve, outputPath)
+	var result GIFResult
+	err := saveToFile(outputPath, func(w io.Writer) (err error) {
+		result, err = EncodeSnake(w, targetImg, curve, frames, delay, opts)
+		return err
+	})
+	return result, err
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// frameSpool 把转换好的调色板帧的像素写到临时目录中，每帧一个文件，编码时再逐帧读回，
+// 内存中只保留不含像素的帧头（尺寸和调色板），用磁盘空间换取内存
+type frameSpool struct {
+	dir string
+	mu  sync.Mutex
+	err error // 第一个写入错误
+}
+
+// newFrameSpool 在系统临时目录下创建一个新的暂存目录，调用方必须在结束后调用 Close 删除它
+func newFrameSpool() (*frameSpool, error) {
+	dir, err := os.MkdirTemp("", "img2video-spool-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	return &frameSpool{dir: dir}, nil
+}
+
+func (s *frameSpool) path(index int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("frame-%06d.pix", index))
+}
+
+// Store 把第 index 帧的像素写入暂存文件，返回不含像素数据的帧头。写入失败时记录第一个错误，由 Err 返回
+func (s *frameSpool) Store(index int, frame *image.Paletted) *image.Paletted {
+	if err := os.WriteFile(s.path(index), frame.Pix, 0600); err != nil {
+		s.mu.Lock()
+		if s.err == nil {
+			s.err = fmt.Errorf("failed to spool frame %d: %w", index, err)
+		}
+		s.mu.Unlock()
+	}
+	return &image.Paletted{Stride: frame.Stride, Rect: frame.Rect, Palette: frame.Palette}
+}
+
+// Err 返回 Store 遇到的第一个错误
+func (s *frameSpool) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Load 读回第 index 帧的像素，返回带有像素数据的完整帧
+func (s *frameSpool) Load(index int, header *image.Paletted) (*image.Paletted, error) {
+	pix, err := os.ReadFile(s.path(index))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spooled frame %d: %w", index, err)
+	}
+	if len(pix) != header.Stride*header.Rect.Dy() {
+		return nil, fmt.Errorf("spooled frame %d has %d bytes, want %d", index, len(pix), header.Stride*header.Rect.Dy())
+	}
+	frame := *header
+	frame.Pix = pix
+	return &frame, nil
+}
+
+// Close 删除暂存目录及其中的所有帧
+func (s *frameSpool) Close() error {
+	return os.RemoveAll(s.dir)
+}
+
+// gifHeaderSize 返回 gif.EncodeAll 输出的单帧 GIF 中文件头、逻辑屏幕描述符和全局调色板的总字节数
+func gifHeaderSize(data []byte) (int, error) {
+	const lsdEnd = 13 // "GIF89a" 加上 7 字节的逻辑屏幕描述符
+	if len(data) < lsdEnd {
+		return 0, errors.New("encoded GIF is too short")
+	}
+	n := lsdEnd
+	if flags := data[10]; flags&0x80 != 0 {
+		n += 3 << ((flags & 0x07) + 1)
+	}
+	return n, nil
+}
+
+// encodeSpooledGIF 与 gif.EncodeAll 输出相同的 GIF，但 g.Image 中的帧只有帧头，像素在编码时才逐帧从 spool 读回，
+// 因此任何时刻只有一帧的像素在内存中。每一帧单独编码为只有一帧的 GIF，再取出其中的图像块拼接起来
+func encodeSpooledGIF(w io.Writer, g *gif.GIF, spool *frameSpool) error {
+	if len(g.Image) == 0 {
+		return errors.New("gif: must provide at least one image")
+	}
+	bw := bufio.NewWriter(w)
+	var buf bytes.Buffer
+	for i, header := range g.Image {
+		frame, err := spool.Load(i, header)
+		if err != nil {
+			return err
+		}
+		one := &gif.GIF{
+			Image:           []*image.Paletted{frame},
+			Delay:           []int{g.Delay[i]},
+			Config:          g.Config,
+			BackgroundIndex: g.BackgroundIndex,
+		}
+		if g.Disposal != nil {
+			one.Disposal = []byte{g.Disposal[i]}
+		}
+		if one.Config == (image.Config{}) {
+			// 与 EncodeAll 一样，逻辑屏幕的尺寸取第一帧的右下角
+			one.Config.Width, one.Config.Height = g.Image[0].Rect.Max.X, g.Image[0].Rect.Max.Y
+		}
+		buf.Reset()
+		if err := gif.EncodeAll(&buf, one); err != nil {
+			return err
+		}
+		data := buf.Bytes()
+		n, err := gifHeaderSize(data)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			bw.Write(data[:n])
+			if len(g.Image) > 1 && g.LoopCount >= 0 {
+				// NETSCAPE2.0 应用扩展，记录循环次数（0 表示无限循环）
+				bw.Write([]byte{0x21, 0xFF, 0x0B})
+				bw.WriteString("NETSCAPE2.0")
+				bw.Write([]byte{0x03, 0x01, byte(g.LoopCount), byte(g.LoopCount >> 8), 0x00})
+			}
+		}
+		// 去掉单帧 GIF 的文件头和最后的结束符，只保留图像块
+		bw.Write(data[n : len(data)-1])
+	}
+	bw.WriteByte(0x3B)
+	return bw.Flush()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// renderStats 是 -stats 写在输出 GIF 旁边的 JSON 文件内容，记录重现这次渲染所需的信息
+type renderStats struct {
+	Algorithm string `json:"algorithm"`
+	Frames    int    `json:"frames"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	// TotalTravel 是所有像素从起点到终点的欧几里得距离之和
+	TotalTravel float64 `json:"totalTravel"`
+	// Seed 是 shuffle 算法使用的种子
+	Seed int64 `json:"seed"`
+	// MotionSeed 是随机运动使用的种子，0 表示按当前时间取种子
+	MotionSeed     int64   `json:"motionSeed"`
+	ElapsedSeconds float64 `json:"elapsedSeconds"`
+}
+
+// statsPath 返回输出文件对应的统计文件路径
+func statsPath(outputPath string) string {
+	return outputPath + ".stats.json"
+}
+
+// saveStats 把渲染统计以缩进的 JSON 格式写入 path
+func saveStats(path string, stats renderStats) error {
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("编码统计信息时出错: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("写入统计文件 %s 时出错: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// textSize 返回以 size 像素的字高绘制 text 时的像素尺寸。字宽和字间距按字高等比缩放，宽度向上取整
+func textSize(text string, size int) (int, int) {
+	return (textWidth(text, 1)*size + glyphHeight - 1) / glyphHeight, size
+}
+
+// textMask 把 text 按 size 像素的字高栅格化为覆盖率遮罩，结果的左上角为原点。
+// 内置点阵字体的每个点是一个正方形，输出像素的值是它被这些正方形覆盖的面积比例，
+// 因此 size 不是 7 的倍数时笔画边缘是抗锯齿的，是 7 的倍数时与整数倍放大的结果完全相同
+func textMask(text string, size int) *image.Alpha {
+	w, h := textSize(text, size)
+	mask := image.NewAlpha(image.Rect(0, 0, w, h))
+	if w == 0 || h == 0 {
+		return mask
+	}
+	// 点阵中的每个点在“细分单位”中宽 size，输出的每个像素宽 glyphHeight，这样所有边界都落在整数上
+	cols := textWidth(text, 1)
+	dots := make([]bool, cols*glyphHeight)
+	col := 0
+	for _, r := range text {
+		glyph := glyphFor(r)
+		for row := 0; row < glyphHeight; row++ {
+			for c := 0; c < glyphWidth; c++ {
+				if glyph[row]&(1<<(glyphWidth-1-c)) != 0 {
+					dots[row*cols+col+c] = true
+				}
+			}
+		}
+		col += glyphWidth + 1
+	}
+	full := glyphHeight * glyphHeight
+	for y := 0; y < h; y++ {
+		y0, y1 := y*glyphHeight, (y+1)*glyphHeight
+		for x := 0; x < w; x++ {
+			x0, x1 := x*glyphHeight, (x+1)*glyphHeight
+			covered := 0
+			for row := y0 / size; row < glyphHeight && row*size < y1; row++ {
+				dy := min(y1, (row+1)*size) - max(y0, row*size)
+				for c := x0 / size; c < cols && c*size < x1; c++ {
+					if dots[row*cols+c] {
+						covered += dy * (min(x1, (c+1)*size) - max(x0, c*size))
+					}
+				}
+			}
+			mask.Pix[mask.PixOffset(x, y)] = uint8((covered*0xFF + full/2) / full)
+		}
+	}
+	return mask
+}
+
+// textCanvas 返回能容纳所有文字的画布尺寸：四周各留出一个字高的边距。
+// size 不为空时直接使用 size 指定的尺寸
+func textCanvas(texts []string, fontSize int, size OutputSize) image.Rectangle {
+	if size.Width > 0 && size.Height > 0 {
+		return image.Rect(0, 0, size.Width, size.Height)
+	}
+	w := 0
+	for _, t := range texts {
+		tw, _ := textSize(t, fontSize)
+		w = max(w, tw)
+	}
+	return image.Rect(0, 0, w+2*fontSize, 3*fontSize)
+}
+
+// renderText 在背景色为 bg 的画布上用前景色 fg 以 fontSize 像素的字高居中绘制一行文字，作为 text 命令的源图像或目标图像
+func renderText(text string, bounds image.Rectangle, fontSize int, fg, bg color.RGBA) (*image.RGBA, error) {
+	mask := textMask(text, fontSize)
+	w, h := mask.Bounds().Dx(), mask.Bounds().Dy()
+	if w > bounds.Dx() || h > bounds.Dy() {
+		return nil, fmt.Errorf("text %q needs %dx%d pixels and does not fit the %dx%d canvas", text, w, h, bounds.Dx(), bounds.Dy())
+	}
+	img := solidImage(bounds, bg)
+	at := image.Pt(bounds.Min.X+(bounds.Dx()-w)/2, bounds.Min.Y+(bounds.Dy()-h)/2)
+	draw.DrawMask(img, image.Rectangle{Min: at, Max: at.Add(mask.Bounds().Size())}, image.NewUniform(fg), image.Point{}, mask, image.Point{}, draw.Over)
+	return img, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// TestTextMask 检查 textMask 按 -fontsize 给出的字高栅格化文字：字高是 7 的倍数时与 drawText 整数倍放大的结果逐像素相同，
+// 否则尺寸按字高等比缩放、笔画边缘有半透明的像素；小写字母不再按大写绘制
+func TestTextMask(t *testing.T) {
+	const text = "Ab9?"
+	for _, scale := range []int{1, 3} {
+		mask := textMask(text, scale*glyphHeight)
+		img := image.NewRGBA(mask.Bounds())
+		drawText(img, 0, 0, text, scale, color.White)
+		if w := textWidth(text, scale); mask.Bounds().Dx() != w {
+			t.Fatalf("size %d: mask is %d pixels wide, drawText draws %d", scale*glyphHeight, mask.Bounds().Dx(), w)
+		}
+		for i, a := range mask.Pix {
+			if want := img.Pix[4*i+3]; a != want {
+				t.Fatalf("size %d: pixel %d has coverage %d, drawText gives %d", scale*glyphHeight, i, a, want)
+			}
+		}
+	}
+
+	mask := textMask(text, 10)
+	if w, h := mask.Bounds().Dx(), mask.Bounds().Dy(); w != 33 || h != 10 {
+		t.Errorf("size 10: mask is %dx%d, want 33x10", w, h)
+	}
+	partial := false
+	for _, a := range mask.Pix {
+		partial = partial || (a != 0 && a != 0xFF)
+	}
+	if !partial {
+		t.Error("size 10: no anti-aliased pixels")
+	}
+
+	if bytes.Equal(textMask("abc", 14).Pix, textMask("ABC", 14).Pix) {
+		t.Error("lowercase text is drawn like uppercase")
+	}
+	if !bytes.Equal(textMask("é", 14).Pix, textMask("?", 14).Pix) {
+		t.Error("a character missing from the font is not drawn as '?'")
+	}
+}
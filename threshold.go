@@ -0,0 +1,59 @@
+package main
+
+import (
+	"image"
+	"sort"
+)
+
+// defaultThresholdMin 和 defaultThresholdMax 是 threshold 算法默认参与排序的灰度范围（包含两端）
+const (
+	defaultThresholdMin = 64.0
+	defaultThresholdMax = 192.0
+)
+
+// thresholdRange 返回 threshold 算法参与排序的灰度范围。ThresholdMin 和 ThresholdMax 都为 0 时返回默认范围：
+// [0, 0] 只包含纯黑的像素，灰度都相同，排序不会移动任何像素，因此把它当作没有设置
+func (o PlanOptions) thresholdRange() (float64, float64) {
+	if o.ThresholdMin == 0 && o.ThresholdMax == 0 {
+		return defaultThresholdMin, defaultThresholdMax
+	}
+	return o.ThresholdMin, o.ThresholdMax
+}
+
+// CreateAnimationPlanThreshold 实现像素排序（pixel sorting）故障艺术效果：在源图像的每一行中，
+// 找出灰度位于 opts 给出的范围（见 thresholdRange）内的连续像素段，把每一段按灰度从暗到亮重新排列，
+// 段外的像素保持不动。与其他算法不同，它不是源图像到目标图像的整体一一对应，像素只在所在的段内移动，
+// 目标图像只提供尺寸，其内容被忽略
+func CreateAnimationPlanThreshold(sourceImg, targetImg image.Image, opts PlanOptions) *AnimationPlan {
+	pixels := imageToPixels(sourceImg)
+	lo, hi := opts.thresholdRange()
+
+	sourcePixels := make([]Pixel, 0, len(pixels))
+	targetPixels := make([]PixelFeatured, 0, len(pixels))
+	inBand := func(p Pixel) bool {
+		return p.GrayscaleValue >= lo && p.GrayscaleValue <= hi
+	}
+	for i := 0; i < len(pixels); {
+		if !inBand(pixels[i]) {
+			sourcePixels = append(sourcePixels, pixels[i])
+			targetPixels = append(targetPixels, PixelFeatured{Pixel: pixels[i]})
+			i++
+			continue
+		}
+		// 同一行中相邻且都在灰度范围内的像素组成一段
+		j := i + 1
+		for j < len(pixels) && inBand(pixels[j]) &&
+			pixels[j].OriginalY == pixels[j-1].OriginalY && pixels[j].OriginalX == pixels[j-1].OriginalX+1 {
+			j++
+		}
+		run := make(Pixels, j-i)
+		copy(run, pixels[i:j])
+		sort.Stable(grayOrder(run, opts.Descending))
+		sourcePixels = append(sourcePixels, run...)
+		for _, p := range pixels[i:j] {
+			targetPixels = append(targetPixels, PixelFeatured{Pixel: p})
+		}
+		i = j
+	}
+	return calculatePlan(sourcePixels, targetPixels, sourceImg.Bounds())
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestThresholdRange 检查 threshold 算法的灰度范围来自 PlanOptions：零值使用默认范围，
+// 不同的范围得到不同的计划，-threshmin 大于 -threshmax 时 createPlan 返回错误
+func TestThresholdRange(t *testing.T) {
+	img := noiseImage(1)
+	plan := func(opts PlanOptions) *AnimationPlan {
+		plan, err := createPlan("threshold", img, img, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return plan
+	}
+	same := func(a, b *AnimationPlan) bool {
+		for i := range a.Pixels {
+			if a.Pixels[i] != b.Pixels[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	defaults := PlanOptions{ThresholdMin: defaultThresholdMin, ThresholdMax: defaultThresholdMax}
+	if !same(plan(PlanOptions{}), plan(defaults)) {
+		t.Error("the zero options do not use the default threshold range")
+	}
+	if same(plan(defaults), plan(PlanOptions{ThresholdMin: 0, ThresholdMax: 255})) {
+		t.Error("the full range 0..255 gives the same plan as the default range")
+	}
+
+	_, err := createPlan("threshold", img, img, PlanOptions{ThresholdMin: 200, ThresholdMax: 100})
+	if err == nil || !strings.Contains(err.Error(), "-threshmin") {
+		t.Errorf("threshold range 200..100 gave error %v, want a -threshmin error", err)
+	}
+}
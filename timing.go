@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+)
+
+// delayForDuration 计算让动画总时长约为 d 的每帧延迟（百分之一秒），帧数按 opts 模拟一遍运动得到，
+// 因此 opts.Seed 为 0 时调用方应先固定一个种子，让输出的 GIF 与模拟的帧数一致。GIF 的延迟最小为 1，
+// 帧数多于 d 所含的百分之一秒数时，提高 FrameStep 跳过部分帧，返回调整后的 FrameStep 和帧数。
+// boomerang 为 true 时倒序返回段的帧（与正向的帧使用相同的延迟）也计入总时长，返回的帧数包含返回段（见 boomerangFrames）
+func delayForDuration(plan *AnimationPlan, opts FrameOptions, d time.Duration, boomerang bool) (delay, step, frames int, err error) {
+	centis := int((d + 5*time.Millisecond) / (10 * time.Millisecond))
+	limit := forwardFrameLimit(centis, boomerang)
+	step = max(1, opts.FrameStep)
+	for {
+		opts.FrameStep = step
+		forward, err := RenderFrames(plan, opts, nil)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		frames = forward
+		if boomerang {
+			frames = boomerangFrames(forward)
+		}
+		if forward <= limit || forward <= 2 {
+			break
+		}
+		// 移动次数约为 (forward-1)*step，按比例估计新的步长，至少加 1 保证循环结束
+		step = max(step+1, ((forward-1)*step+limit-2)/(limit-1))
+	}
+	return max(1, (centis+frames/2)/frames), step, frames, nil
+}
+
+// FrameTiming 由 GIF 实际写入的每一帧的延迟（百分之一秒，见 GIFResult.Delays）返回每一帧的开始时间（从 0 开始累计），
+// 可用于视频封装时设置每一帧的 PTS。直接使用编码器的结果，因此帧数和时间总是与输出的 GIF 一致，
+// 包括倒序返回段、合并的相同帧和 -loopdelay
+func FrameTiming(delays []int) []time.Duration {
+	times := make([]time.Duration, len(delays))
+	var t time.Duration
+	for i, d := range delays {
+		times[i] = t
+		t += time.Duration(d) * 10 * time.Millisecond
+	}
+	return times
+}
+
+// writeTimestamps 以 mkvmerge 的 timestamp format v2 写出每一帧的开始时间（毫秒，每行一帧），
+// 可以直接交给 mkvmerge --timestamps，或转换为 ffmpeg concat 文件中的 duration
+func writeTimestamps(w io.Writer, times []time.Duration) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# timestamp format v2")
+	for _, t := range times {
+		fmt.Fprintf(bw, "%d\n", t.Milliseconds())
+	}
+	return bw.Flush()
+}
+
+// SaveTimestamps 由 GIF 每一帧的延迟计算帧时间并保存到 path
+func SaveTimestamps(delays []int, path string) error {
+	times := FrameTiming(delays)
+	return saveToFile(path, func(w io.Writer) error { return writeTimestamps(w, times) })
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"image/gif"
+	"io"
+	"testing"
+	"time"
+)
+
+// TestFrameTimingMatchesGIF 检查时间戳来自编码器实际写入的延迟：没有种子的 random 运动每次运行的帧数不同，
+// 加上倒序返回段、合并相同帧和 -loopdelay 之后，时间戳的帧数和时间仍然与解码出的 GIF 完全一致
+func TestFrameTimingMatchesGIF(t *testing.T) {
+	fx := fixturePairs()[0]
+	plan := CreateAnimationPlan(fx.Source, fx.Target, PlanOptions{})
+	opts := GIFOptions{FrameOptions: FrameOptions{Motion: "random"}, Boomerang: true, Trim: true, LoopDelay: 40}
+	var buf bytes.Buffer
+	result, err := EncodeGIF(&buf, plan, 3, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	times := FrameTiming(result.Delays)
+	if len(times) != len(g.Image) {
+		t.Fatalf("%d timestamps for %d GIF frames", len(times), len(g.Image))
+	}
+	var want time.Duration
+	for i, d := range g.Delay {
+		if times[i] != want {
+			t.Fatalf("frame %d starts at %v, want %v", i, times[i], want)
+		}
+		want += time.Duration(d) * 10 * time.Millisecond
+	}
+}
+
+// TestDelayForDurationBoomerang 检查 delayForDuration 选择的延迟和步长让 GIF 的总时长接近 -duration，
+// 包括 Boomerang 时的倒序返回段（否则总时长约为两倍）
+func TestDelayForDurationBoomerang(t *testing.T) {
+	fx := fixturePairs()[3]
+	plan := CreateAnimationPlan(fx.Source, fx.Target, PlanOptions{})
+	for _, boomerang := range []bool{false, true} {
+		for _, d := range []time.Duration{200 * time.Millisecond, time.Second, 3 * time.Second} {
+			frameOpts := FrameOptions{Motion: "dither", Seed: 1}
+			delay, step, frames, err := delayForDuration(plan, frameOpts, d, boomerang)
+			if err != nil {
+				t.Fatal(err)
+			}
+			frameOpts.FrameStep = step
+			result, err := EncodeGIF(io.Discard, plan, delay, GIFOptions{FrameOptions: frameOpts, Boomerang: boomerang})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Frames != frames {
+				t.Errorf("boomerang %v, %v: expected %d frames, the GIF has %d", boomerang, d, frames, result.Frames)
+			}
+			got := time.Duration(result.TotalDelay) * 10 * time.Millisecond
+			// 延迟取整到百分之一秒，每帧最多差半个单位
+			if tolerance := time.Duration(frames) * 5 * time.Millisecond; got < d-tolerance || got > d+tolerance {
+				t.Errorf("boomerang %v: the GIF lasts %v, want about %v", boomerang, got, d)
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+)
+
+// Transform 描述读取源图后执行的几何变换：先顺时针旋转 Rotate 度，再按 Flip 翻转
+type Transform struct {
+	Rotate int    // 0、90、180 或 270
+	Flip   string // ""、"h"（水平翻转）或 "v"（垂直翻转）
+}
+
+// Apply 对图像执行变换，结果的原点为 (0, 0)。没有任何变换时直接返回原图
+func (t Transform) Apply(img image.Image) (image.Image, error) {
+	if t.Rotate == 0 && t.Flip == "" {
+		return img, nil
+	}
+	rotated, err := rotateImage(img, t.Rotate)
+	if err != nil {
+		return nil, err
+	}
+	return flipImage(rotated, t.Flip)
+}
+
+// rotateImage 把图像顺时针旋转 degrees 度（只支持 90 的倍数）
+func rotateImage(img image.Image, degrees int) (*image.RGBA, error) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	var dst *image.RGBA
+	var mapTo func(x, y int) (int, int) // 源图中相对坐标 (x, y) 在结果中的位置
+	switch ((degrees % 360) + 360) % 360 {
+	case 0:
+		dst = image.NewRGBA(image.Rect(0, 0, w, h))
+		mapTo = func(x, y int) (int, int) { return x, y }
+	case 90:
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+		mapTo = func(x, y int) (int, int) { return h - 1 - y, x }
+	case 180:
+		dst = image.NewRGBA(image.Rect(0, 0, w, h))
+		mapTo = func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }
+	case 270:
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+		mapTo = func(x, y int) (int, int) { return y, w - 1 - x }
+	default:
+		return nil, fmt.Errorf("unsupported rotation: %d. Please use 0, 90, 180 or 270", degrees)
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := mapTo(x, y)
+			dst.SetRGBA(dx, dy, toRGBA(img.At(b.Min.X+x, b.Min.Y+y)))
+		}
+	}
+	return dst, nil
+}
+
+// flipImage 水平（"h"）或垂直（"v"）翻转图像，dir 为空时返回原图的副本
+func flipImage(img image.Image, dir string) (*image.RGBA, error) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	var mapTo func(x, y int) (int, int)
+	switch strings.ToLower(dir) {
+	case "":
+		mapTo = func(x, y int) (int, int) { return x, y }
+	case "h":
+		mapTo = func(x, y int) (int, int) { return w - 1 - x, y }
+	case "v":
+		mapTo = func(x, y int) (int, int) { return x, h - 1 - y }
+	default:
+		return nil, fmt.Errorf("unsupported flip: %s. Please use 'h' or 'v'", dir)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := mapTo(x, y)
+			dst.SetRGBA(dx, dy, toRGBA(img.At(b.Min.X+x, b.Min.Y+y)))
+		}
+	}
+	return dst, nil
+}
+
+// parseInvert 解析 -invert 的取值，返回是否反相源图和目标图。空字符串表示都不反相
+func parseInvert(s string) (source, target bool, err error) {
+	switch strings.ToLower(s) {
+	case "":
+		return false, false, nil
+	case "src":
+		return true, false, nil
+	case "tgt":
+		return false, true, nil
+	case "both":
+		return true, true, nil
+	default:
+		return false, false, fmt.Errorf("unsupported invert: %s. Please use 'src', 'tgt' or 'both'", s)
+	}
+}
+
+// invertImage 返回颜色反相（每个颜色分量取 255-c）的图像副本，alpha 保持不变。
+// image.RGBA 以预乘 alpha 存储颜色，反相后的预乘分量为 alpha-c
+func invertImage(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := toRGBA(img.At(x, y))
+			dst.SetRGBA(x, y, color.RGBA{c.A - c.R, c.A - c.G, c.A - c.B, c.A})
+		}
+	}
+	return dst
+}
+
+// applyInvert 按 -invert 的取值反相源图和目标图，返回处理后的两张图像
+func applyInvert(which string, sourceImg, targetImg image.Image) (image.Image, image.Image, error) {
+	invertSource, invertTarget, err := parseInvert(which)
+	if err != nil {
+		return nil, nil, err
+	}
+	if invertSource {
+		sourceImg = invertImage(sourceImg)
+	}
+	if invertTarget {
+		targetImg = invertImage(targetImg)
+	}
+	return sourceImg, targetImg, nil
+}
+
+// contentBounds 返回图像中内容（非背景像素）的外接矩形，全部是背景时返回空矩形。
+// 背景色取左上角的像素：完全透明的像素，以及每个颜色分量与背景色相差不超过 tolerance 的像素都算作背景
+func contentBounds(img image.Image, tolerance int) image.Rectangle {
+	b := img.Bounds()
+	bg := toRGBA(img.At(b.Min.X, b.Min.Y))
+	near := func(a, b uint8) bool { return abs(int(a)-int(b)) <= tolerance }
+	content := image.Rectangle{}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := toRGBA(img.At(x, y))
+			if c.A == 0 || near(c.R, bg.R) && near(c.G, bg.G) && near(c.B, bg.B) && near(c.A, bg.A) {
+				continue
+			}
+			content = content.Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+	return content
+}
+
+// cropToContent 把尺寸相同的源图和目标图裁剪到两者内容外接矩形的交集（见 contentBounds），
+// 去掉大片的纯色或透明边框，减少参与重排的像素和移动距离。返回的图像原点为 (0, 0)，
+// 以及裁剪区域在原图中的位置。交集为空时返回错误
+func cropToContent(sourceImg, targetImg image.Image, tolerance int) (image.Image, image.Image, image.Rectangle, error) {
+	if tolerance < 0 || tolerance > 255 {
+		return nil, nil, image.Rectangle{}, fmt.Errorf("invalid crop tolerance %d: must be between 0 and 255", tolerance)
+	}
+	r := contentBounds(sourceImg, tolerance).Intersect(contentBounds(targetImg, tolerance))
+	if r.Empty() {
+		return nil, nil, image.Rectangle{}, fmt.Errorf("nothing left after cropping to content: the content of the source and target does not overlap")
+	}
+	if r == sourceImg.Bounds() {
+		return sourceImg, targetImg, r, nil
+	}
+	crop := func(img image.Image) image.Image {
+		dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+		draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+		return dst
+	}
+	return crop(sourceImg), crop(targetImg), r, nil
+}
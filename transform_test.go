@@ -0,0 +1,82 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// TestRotateImageCorners 用四个角颜色不同的 3x2 图像检查 rotateImage 把每个角旋转到正确的位置：
+// 顺时针 90 度时左上角到右上角、右上角到右下角、右下角到左下角、左下角到左上角，结果的宽高互换
+func TestRotateImageCorners(t *testing.T) {
+	topLeft := color.RGBA{0xFF, 0, 0, 0xFF}
+	topRight := color.RGBA{0, 0xFF, 0, 0xFF}
+	bottomRight := color.RGBA{0, 0, 0xFF, 0xFF}
+	bottomLeft := color.RGBA{0xFF, 0xFF, 0, 0xFF}
+	// 原点不在 (0, 0)，同时检查结果的原点为 (0, 0)
+	src := image.NewRGBA(image.Rect(5, 5, 8, 7))
+	src.SetRGBA(5, 5, topLeft)
+	src.SetRGBA(7, 5, topRight)
+	src.SetRGBA(7, 6, bottomRight)
+	src.SetRGBA(5, 6, bottomLeft)
+
+	tests := []struct {
+		degrees int
+		bounds  image.Rectangle
+		corners [4]color.RGBA // 结果的左上、右上、右下、左下角
+	}{
+		{90, image.Rect(0, 0, 2, 3), [4]color.RGBA{bottomLeft, topLeft, topRight, bottomRight}},
+		{-270, image.Rect(0, 0, 2, 3), [4]color.RGBA{bottomLeft, topLeft, topRight, bottomRight}},
+		{180, image.Rect(0, 0, 3, 2), [4]color.RGBA{bottomRight, bottomLeft, topLeft, topRight}},
+		{270, image.Rect(0, 0, 2, 3), [4]color.RGBA{topRight, bottomRight, bottomLeft, topLeft}},
+		{360, image.Rect(0, 0, 3, 2), [4]color.RGBA{topLeft, topRight, bottomRight, bottomLeft}},
+	}
+	for _, tt := range tests {
+		got, err := rotateImage(src, tt.degrees)
+		if err != nil {
+			t.Fatalf("rotate %d: %v", tt.degrees, err)
+		}
+		if got.Bounds() != tt.bounds {
+			t.Errorf("rotate %d: bounds %v, want %v", tt.degrees, got.Bounds(), tt.bounds)
+			continue
+		}
+		b := got.Bounds()
+		corners := [4]color.RGBA{
+			got.RGBAAt(0, 0),
+			got.RGBAAt(b.Max.X-1, 0),
+			got.RGBAAt(b.Max.X-1, b.Max.Y-1),
+			got.RGBAAt(0, b.Max.Y-1),
+		}
+		if corners != tt.corners {
+			t.Errorf("rotate %d: corners (top-left, top-right, bottom-right, bottom-left) = %v, want %v", tt.degrees, corners, tt.corners)
+		}
+	}
+
+	if _, err := rotateImage(src, 45); err == nil {
+		t.Error("rotate 45 succeeded, want an error")
+	}
+}
+
+// TestInvertImage 检查反相两次得到原图，并且不透明图像反相后的灰度总和等于 255 乘以像素数减去原来的灰度总和
+func TestInvertImage(t *testing.T) {
+	for _, fx := range fixturePairs() {
+		img := fx.Source
+		inverted := invertImage(img)
+		b := img.Bounds()
+		want := 255*float64(b.Dx()*b.Dy()) - CalculateGrayscaleSum(img)
+		if sum := CalculateGrayscaleSum(inverted); math.Abs(sum-want) > 0.01 {
+			t.Errorf("%s: inverted grayscale sum %f, want %f", fx.Name, sum, want)
+		}
+		twice := invertImage(inverted)
+	pixels:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if got, orig := twice.RGBAAt(x, y), toRGBA(img.At(x, y)); got != orig {
+					t.Errorf("%s: pixel (%d,%d) is %v after inverting twice, want %v", fx.Name, x, y, got, orig)
+					break pixels
+				}
+			}
+		}
+	}
+}
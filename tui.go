@@ -0,0 +1,180 @@
+//go:build !(js && wasm)
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// handleTUI 在终端中以半块字符逐帧预览动画，可用方向键前后翻动帧
+func handleTUI(cfg Config) {
+	fs := flag.NewFlagSet("tui", flag.ExitOnError)
+	maxPixels := fs.Int("maxpixels", cfg.MaxPixels, "maximum number of pixels per input image (0 disables the limit)")
+	frameStep := fs.Int("framestep", cfg.FrameStep, "number of movement steps per emitted frame")
+	motion := fs.String("motion", cfg.Motion, "pixel motion: random, dither, deterministic, line, gravity or wave")
+	maxStep := fs.Int("maxstep", 0, "cap the per-frame step of the random and dither motions, for smoother motion on large images (0 disables)")
+	waveWidth := fs.Float64("wavewidth", defaultWaveWidth, "fraction of the animation each pixel spends moving in the wave motion (0-1)")
+	jitter := fs.Float64("jitter", 0, "randomly offset moving pixels up to this many pixels perpendicular to their path (0 disables)")
+	seed := fs.Int64("seed", 1, "random seed for the shuffle algorithm")
+	threshMin := fs.Float64("threshmin", defaultThresholdMin, "lowest grayscale sorted by the threshold algorithm")
+	threshMax := fs.Float64("threshmax", defaultThresholdMax, "highest grayscale sorted by the threshold algorithm")
+	sortDesc := fs.Bool("sortdesc", false, "sort pixels from bright to dark instead of dark to bright")
+	fs.Parse(os.Args[2:])
+	planOpts := PlanOptions{Seed: *seed, ThresholdMin: *threshMin, ThresholdMax: *threshMax, Descending: *sortDesc}
+	if err := checkPlanOptions(planOpts); err != nil {
+		fatalf("Error: %v", err)
+	}
+	args := fs.Args()
+
+	if len(args) < 2 {
+		printUsage()
+		exit(1)
+	}
+	algorithm := cfg.Algorithm
+	if len(args) > 2 {
+		algorithm = args[2]
+	}
+
+	sourceImg, err := readImage(args[0], *maxPixels)
+	if err != nil {
+		fatalf("Error reading source image: %v", err)
+	}
+	targetImg, err := readImage(args[1], *maxPixels)
+	if err != nil {
+		fatalf("Error reading target image: %v", err)
+	}
+	if err := checkDimensions(sourceImg, targetImg); err != nil {
+		fatalf("Error: %v", err)
+	}
+
+	plan, err := createPlan(algorithm, sourceImg, targetImg, planOpts)
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		fatalf("Error: the tui command needs an interactive terminal: %v", err)
+	}
+	defer tty.Close()
+
+	// 每个字符单元显示上下两个像素，最后一行留给状态栏
+	cols, rows := terminalSize(tty)
+	w, h := fitSize(plan.Bounds.Dx(), plan.Bounds.Dy(), cols, (rows-1)*2)
+
+	log.Println("Rendering frames for preview...")
+	var frames []*image.RGBA
+	_, err = RenderFrames(plan, FrameOptions{FrameStep: *frameStep, Motion: *motion, MaxStep: *maxStep, WaveWidth: *waveWidth, Jitter: *jitter}, func(frame *image.RGBA) {
+		frames = append(frames, Resample(frame, w, h, ResampleNearest))
+	})
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+
+	if err := runTUI(tty, frames); err != nil {
+		fatalf("Error: %v", err)
+	}
+}
+
+// terminalSize 通过 stty 查询终端的列数和行数，查询失败时返回 80x24
+func terminalSize(tty *os.File) (cols, rows int) {
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = tty
+	out, err := cmd.Output()
+	if err != nil {
+		return 80, 24
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return 80, 24
+	}
+	rows, errRows := strconv.Atoi(fields[0])
+	cols, errCols := strconv.Atoi(fields[1])
+	if errRows != nil || errCols != nil || rows < 2 || cols < 1 {
+		return 80, 24
+	}
+	return cols, rows
+}
+
+// runTUI 切换终端到原始模式并处理按键，直到用户按下 q
+func runTUI(tty *os.File, frames []*image.RGBA) error {
+	saved, err := sttyOutput(tty, "-g")
+	if err != nil {
+		return fmt.Errorf("failed to read terminal state: %w", err)
+	}
+	if _, err := sttyOutput(tty, "-icanon", "-echo", "min", "1"); err != nil {
+		return fmt.Errorf("failed to switch terminal to raw mode: %w", err)
+	}
+	// 进入备用屏幕并隐藏光标，退出时恢复
+	fmt.Fprint(tty, "\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Fprint(tty, "\x1b[0m\x1b[?25h\x1b[?1049l")
+		sttyOutput(tty, strings.TrimSpace(saved))
+	}()
+
+	current := 0
+	buf := make([]byte, 8)
+	for {
+		drawFrame(tty, frames[current], current, len(frames))
+
+		n, err := tty.Read(buf)
+		if err != nil {
+			return fmt.Errorf("failed to read key: %w", err)
+		}
+		switch key := string(buf[:n]); key {
+		case "q", "Q", "\x03":
+			return nil
+		case "\x1b[C", "l", " ":
+			current++
+		case "\x1b[D", "h":
+			current--
+		case "\x1b[A", "k":
+			current += 10
+		case "\x1b[B", "j":
+			current -= 10
+		case "g":
+			current = 0
+		case "G":
+			current = len(frames) - 1
+		}
+		current = max(0, min(current, len(frames)-1))
+	}
+}
+
+// sttyOutput 以 tty 为标准输入执行 stty 并返回其输出
+func sttyOutput(tty *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// drawFrame 使用 24 位色的上半块字符绘制一帧，并在底部显示状态栏
+func drawFrame(w io.Writer, frame *image.RGBA, index, total int) {
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+
+	b := frame.Bounds()
+	fmt.Fprint(bw, "\x1b[H")
+	for y := b.Min.Y; y < b.Max.Y; y += 2 {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			top := frame.RGBAAt(x, y)
+			bottom := top
+			if y+1 < b.Max.Y {
+				bottom = frame.RGBAAt(x, y+1)
+			}
+			fmt.Fprintf(bw, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm▀", top.R, top.G, top.B, bottom.R, bottom.G, bottom.B)
+		}
+		fmt.Fprint(bw, "\x1b[0m\x1b[K\r\n")
+	}
+	fmt.Fprintf(bw, "\x1b[0m\x1b[Kframe %d/%d  ←/→ step  ↑/↓ jump 10  g/G first/last  q quit", index+1, total)
+}
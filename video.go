@@ -0,0 +1,186 @@
+//go:build !(js && wasm)
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// VideoOptions 控制 SaveVideo 的可选行为
+type VideoOptions struct {
+	FrameOptions
+	// FPS 是视频的帧率
+	FPS int
+	// Audio 是混入视频的音频文件路径，为空时生成无声视频。音频比视频长时被截断，短时循环播放
+	Audio string
+}
+
+// ffmpegArgs 返回把标准输入中 w x h 的原始 RGBA 帧编码为 H.264 视频所需的 ffmpeg 参数
+func ffmpegArgs(w, h int, outputPath string, opts VideoOptions) []string {
+	args := []string{
+		"-y", "-loglevel", "error",
+		"-f", "rawvideo", "-pix_fmt", "rgba", "-s", fmt.Sprintf("%dx%d", w, h), "-r", strconv.Itoa(opts.FPS), "-i", "-",
+	}
+	if opts.Audio != "" {
+		// -stream_loop -1 无限循环音频，再由 -shortest 截断到视频的长度
+		args = append(args, "-stream_loop", "-1", "-i", opts.Audio, "-map", "0:v", "-map", "1:a", "-c:a", "aac", "-shortest")
+	}
+	// yuv420p 要求宽高都是偶数，奇数尺寸时补齐一行或一列
+	return append(args, "-vf", "pad=ceil(iw/2)*2:ceil(ih/2)*2", "-c:v", "libx264", "-pix_fmt", "yuv420p", outputPath)
+}
+
+// SaveVideo 根据 AnimationPlan 生成动画帧，通过管道交给 ffmpeg 编码为视频文件。需要 PATH 中有 ffmpeg
+func SaveVideo(plan *AnimationPlan, outputPath string, opts VideoOptions) error {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return fmt.Errorf("the video command needs ffmpeg, but it was not found in PATH: %w", err)
+	}
+	if opts.Audio != "" {
+		if _, err := os.Stat(opts.Audio); err != nil {
+			return fmt.Errorf("failed to open audio file: %w", err)
+		}
+	}
+	if opts.FPS < 1 {
+		return fmt.Errorf("invalid frame rate %d", opts.FPS)
+	}
+
+	bounds := plan.Bounds
+	var stderr bytes.Buffer
+	cmd := exec.Command(ffmpeg, ffmpegArgs(bounds.Dx(), bounds.Dy(), outputPath, opts)...)
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to connect to ffmpeg: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	log.Printf("正在生成动画帧并通过 ffmpeg 编码到 %s...", outputPath)
+	var writeErr error
+	count, err := RenderFrames(plan, opts.FrameOptions, func(frame *image.RGBA) {
+		if writeErr == nil {
+			_, writeErr = stdin.Write(frame.Pix)
+		}
+	})
+	stdin.Close()
+	waitErr := cmd.Wait()
+	if err != nil {
+		return err
+	}
+	if waitErr != nil {
+		return fmt.Errorf("ffmpeg failed: %w: %s", waitErr, strings.TrimSpace(stderr.String()))
+	}
+	if writeErr != nil {
+		return fmt.Errorf("failed to write frames to ffmpeg: %w", writeErr)
+	}
+	log.Printf("已编码 %d 帧。", count)
+	return nil
+}
+
+// handleVideo 生成动画并用 ffmpeg 编码为 MP4 等视频文件，可以混入背景音乐
+func handleVideo(cfg Config) {
+	fs := flag.NewFlagSet("video", flag.ExitOnError)
+	fps := fs.Int("fps", 30, "video frame rate")
+	audio := fs.String("audio", "", "audio file muxed into the video, trimmed or looped to the video length")
+	maxPixels := fs.Int("maxpixels", cfg.MaxPixels, "maximum number of pixels per input image (0 disables the limit)")
+	frameStep := fs.Int("framestep", cfg.FrameStep, "number of movement steps per emitted frame")
+	motion := fs.String("motion", cfg.Motion, "pixel motion: random, dither, deterministic, line, gravity or wave")
+	maxStep := fs.Int("maxstep", 0, "cap the per-frame step of the random and dither motions, for smoother motion on large images (0 disables)")
+	waveWidth := fs.Float64("wavewidth", defaultWaveWidth, "fraction of the animation each pixel spends moving in the wave motion (0-1)")
+	jitter := fs.Float64("jitter", 0, "randomly offset moving pixels up to this many pixels perpendicular to their path (0 disables)")
+	seed := fs.Int64("seed", 1, "random seed for the shuffle algorithm")
+	threshMin := fs.Float64("threshmin", defaultThresholdMin, "lowest grayscale sorted by the threshold algorithm")
+	threshMax := fs.Float64("threshmax", defaultThresholdMax, "highest grayscale sorted by the threshold algorithm")
+	sortDesc := fs.Bool("sortdesc", false, "sort pixels from bright to dark instead of dark to bright")
+	timeout := fs.Duration("timeout", 0, "abort the render if it takes longer than this, e.g. 30s (0 disables)")
+	fs.Parse(os.Args[2:])
+	planOpts := PlanOptions{Seed: *seed, ThresholdMin: *threshMin, ThresholdMax: *threshMax, Descending: *sortDesc}
+	if err := checkPlanOptions(planOpts); err != nil {
+		fatalf("Error: %v", err)
+	}
+	args := fs.Args()
+
+	if len(args) < 3 {
+		printUsage()
+		exit(1)
+	}
+	outputPath := args[2]
+	algorithm := cfg.Algorithm
+	if len(args) > 3 {
+		algorithm = args[3]
+	}
+
+	sourceImg, err := readImage(args[0], *maxPixels)
+	if err != nil {
+		fatalf("Error reading source image: %v", err)
+	}
+	targetImg, err := readImage(args[1], *maxPixels)
+	if err != nil {
+		fatalf("Error reading target image: %v", err)
+	}
+	if err := checkDimensions(sourceImg, targetImg); err != nil {
+		fatalf("Error: %v", err)
+	}
+
+	plan, err := createPlan(algorithm, sourceImg, targetImg, planOpts)
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+
+	frameOpts := FrameOptions{FrameStep: *frameStep, Motion: *motion, MaxStep: *maxStep, WaveWidth: *waveWidth, Jitter: *jitter}
+	defer withTimeout(&frameOpts, *timeout)()
+	if isMJPEGOutput(outputPath) {
+		if *audio != "" {
+			fatalf("Error: -audio cannot be used with Motion-JPEG output.")
+		}
+		if err := saveMJPEGOutput(plan, outputPath, *fps, frameOpts); err != nil {
+			exitOnTimeout(err, *timeout, outputPath)
+			fatalf("Error saving Motion-JPEG stream: %v", err)
+		}
+		return
+	}
+
+	err = SaveVideo(plan, outputPath, VideoOptions{
+		FrameOptions: frameOpts,
+		FPS:          *fps,
+		Audio:        *audio,
+	})
+	if err != nil {
+		exitOnTimeout(err, *timeout, outputPath)
+		fatalf("Error saving video: %v", err)
+	}
+	log.Printf("Video saved successfully to: %s", outputPath)
+}
+
+// isMJPEGOutput 判断 video 命令的输出是否为 Motion-JPEG 流：输出为 - 或扩展名为 .mjpeg/.mjpg
+func isMJPEGOutput(outputPath string) bool {
+	ext := strings.ToLower(filepath.Ext(outputPath))
+	return outputPath == "-" || ext == ".mjpeg" || ext == ".mjpg"
+}
+
+// saveMJPEGOutput 把 Motion-JPEG 流写到文件，或在输出为 - 时按 fps 的节奏实时写到标准输出
+func saveMJPEGOutput(plan *AnimationPlan, outputPath string, fps int, opts FrameOptions) error {
+	if fps < 1 {
+		return fmt.Errorf("invalid frame rate %d", fps)
+	}
+	if outputPath == "-" {
+		return SaveMJPEG(plan, os.Stdout, fps, opts)
+	}
+	err := saveToFile(outputPath, func(w io.Writer) error { return SaveMJPEG(plan, w, 0, opts) })
+	if err != nil {
+		return err
+	}
+	log.Printf("Motion-JPEG stream saved successfully to: %s", outputPath)
+	return nil
+}